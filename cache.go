@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/node/api"
+	"golang.org/x/sync/singleflight"
+)
+
+// defaultCacheTTLs caches the responses of the endpoints that are expensive
+// for siad to compute.
+const defaultCacheTTLs = "/hostdb/all=1m,/renter/dir=1m,/renter/contracts=1m"
+
+var (
+	cacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sia_exporter_cache_requests_total", Help: "Number of Sia API requests by endpoint and cache result (hit, miss or shared with a concurrent request)"}, []string{"endpoint", "result"})
+
+	// cacheEndpoints lists the endpoints the collectors call, which are the
+	// endpoints that can be cached.
+	cacheEndpoints = []string{
+		"/consensus",
+		"/daemon/settings",
+		"/gateway",
+		"/host",
+		"/host/storage",
+		"/hostdb/all",
+		"/renter",
+		"/renter/contracts",
+		"/renter/dir",
+		"/wallet",
+		"/wallet/addresses",
+	}
+)
+
+// apiClient is the part of the Sia API client used by the collectors.
+type apiClient interface {
+	ConsensusGet(ctx context.Context) (api.ConsensusGET, error)
+	DaemonSettingsGet(ctx context.Context) (api.DaemonSettingsGet, error)
+	GatewayGet(ctx context.Context) (api.GatewayGET, error)
+	HostGet(ctx context.Context) (api.HostGET, error)
+	HostStorageGet(ctx context.Context) (api.StorageGET, error)
+	HostDbAllGet(ctx context.Context) (api.HostdbAllGET, error)
+	RenterGet(ctx context.Context) (api.RenterGET, error)
+	RenterDisabledContractsGet(ctx context.Context) (api.RenterContracts, error)
+	RenterDirGet(ctx context.Context, siaPath modules.SiaPath) (api.RenterDirectory, error)
+	WalletGet(ctx context.Context) (api.WalletGET, error)
+	WalletAddressesGet(ctx context.Context) (api.WalletAddressesGET, error)
+}
+
+// cacheEntry is a cached API response.
+type cacheEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+// cachedClient is an apiClient that caches the responses of another apiClient
+// for a configurable time per endpoint. Concurrent requests for the same
+// endpoint are always combined into a single request, whether the endpoint is
+// cached or not.
+type cachedClient struct {
+	client apiClient
+	ttls   map[string]time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	group   singleflight.Group
+}
+
+// newCachedClient creates a cachedClient in front of client. Responses of an
+// endpoint are cached for ttls[endpoint], endpoints without a TTL are not
+// cached.
+func newCachedClient(client apiClient, ttls map[string]time.Duration) *cachedClient {
+	return &cachedClient{
+		client:  client,
+		ttls:    ttls,
+		entries: make(map[string]cacheEntry),
+	}
+}
+
+// parseCacheTTLs parses a comma separated list of endpoint=duration pairs.
+func parseCacheTTLs(s string) (map[string]time.Duration, error) {
+	ttls := make(map[string]time.Duration)
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid cache TTL %q, must be endpoint=duration", pair)
+		}
+		endpoint := strings.TrimSpace(kv[0])
+		if !isCacheEndpoint(endpoint) {
+			return nil, fmt.Errorf("unknown endpoint %q, must be one of %v", endpoint, strings.Join(cacheEndpoints, ", "))
+		}
+		ttl, err := time.ParseDuration(strings.TrimSpace(kv[1]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid cache TTL for %v: %v", endpoint, err)
+		}
+		ttls[endpoint] = ttl
+	}
+	return ttls, nil
+}
+
+// isCacheEndpoint returns whether endpoint is one of the cacheEndpoints.
+func isCacheEndpoint(endpoint string) bool {
+	for _, e := range cacheEndpoints {
+		if e == endpoint {
+			return true
+		}
+	}
+	return false
+}
+
+// get returns the cached response of the endpoint identified by key, or calls
+// fetch to get it. Errors are never cached. A call shared with a concurrent
+// request is given up on when ctx is done.
+func (c *cachedClient) get(ctx context.Context, endpoint, key string, fetch func() (interface{}, error)) (interface{}, error) {
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && time.Now().Before(e.expires) {
+		cacheRequests.WithLabelValues(endpoint, "hit").Inc()
+		return e.value, nil
+	}
+
+	done := c.group.DoChan(key, func() (interface{}, error) {
+		v, err := fetch()
+		if ttl := c.ttls[endpoint]; err == nil && ttl > 0 {
+			c.mu.Lock()
+			c.entries[key] = cacheEntry{value: v, expires: time.Now().Add(ttl)}
+			c.mu.Unlock()
+		}
+		return v, err
+	})
+	select {
+	case res := <-done:
+		if res.Shared {
+			cacheRequests.WithLabelValues(endpoint, "shared").Inc()
+		} else {
+			cacheRequests.WithLabelValues(endpoint, "miss").Inc()
+		}
+		return res.Val, res.Err
+	case <-ctx.Done():
+		// Not counted, as whether the call was shared is not known yet
+		return nil, ctx.Err()
+	}
+}
+
+// ConsensusGet implements apiClient.
+func (c *cachedClient) ConsensusGet(ctx context.Context) (api.ConsensusGET, error) {
+	v, err := c.get(ctx, "/consensus", "/consensus", func() (interface{}, error) { return c.client.ConsensusGet(ctx) })
+	cg, _ := v.(api.ConsensusGET)
+	return cg, err
+}
+
+// DaemonSettingsGet implements apiClient.
+func (c *cachedClient) DaemonSettingsGet(ctx context.Context) (api.DaemonSettingsGet, error) {
+	v, err := c.get(ctx, "/daemon/settings", "/daemon/settings", func() (interface{}, error) { return c.client.DaemonSettingsGet(ctx) })
+	dsg, _ := v.(api.DaemonSettingsGet)
+	return dsg, err
+}
+
+// GatewayGet implements apiClient.
+func (c *cachedClient) GatewayGet(ctx context.Context) (api.GatewayGET, error) {
+	v, err := c.get(ctx, "/gateway", "/gateway", func() (interface{}, error) { return c.client.GatewayGet(ctx) })
+	gg, _ := v.(api.GatewayGET)
+	return gg, err
+}
+
+// HostGet implements apiClient.
+func (c *cachedClient) HostGet(ctx context.Context) (api.HostGET, error) {
+	v, err := c.get(ctx, "/host", "/host", func() (interface{}, error) { return c.client.HostGet(ctx) })
+	hg, _ := v.(api.HostGET)
+	return hg, err
+}
+
+// HostStorageGet implements apiClient.
+func (c *cachedClient) HostStorageGet(ctx context.Context) (api.StorageGET, error) {
+	v, err := c.get(ctx, "/host/storage", "/host/storage", func() (interface{}, error) { return c.client.HostStorageGet(ctx) })
+	sg, _ := v.(api.StorageGET)
+	return sg, err
+}
+
+// HostDbAllGet implements apiClient.
+func (c *cachedClient) HostDbAllGet(ctx context.Context) (api.HostdbAllGET, error) {
+	v, err := c.get(ctx, "/hostdb/all", "/hostdb/all", func() (interface{}, error) { return c.client.HostDbAllGet(ctx) })
+	hdg, _ := v.(api.HostdbAllGET)
+	return hdg, err
+}
+
+// RenterGet implements apiClient.
+func (c *cachedClient) RenterGet(ctx context.Context) (api.RenterGET, error) {
+	v, err := c.get(ctx, "/renter", "/renter", func() (interface{}, error) { return c.client.RenterGet(ctx) })
+	rg, _ := v.(api.RenterGET)
+	return rg, err
+}
+
+// RenterDisabledContractsGet implements apiClient.
+func (c *cachedClient) RenterDisabledContractsGet(ctx context.Context) (api.RenterContracts, error) {
+	v, err := c.get(ctx, "/renter/contracts", "/renter/contracts", func() (interface{}, error) { return c.client.RenterDisabledContractsGet(ctx) })
+	rc, _ := v.(api.RenterContracts)
+	return rc, err
+}
+
+// RenterDirGet implements apiClient.
+func (c *cachedClient) RenterDirGet(ctx context.Context, siaPath modules.SiaPath) (api.RenterDirectory, error) {
+	v, err := c.get(ctx, "/renter/dir", "/renter/dir/"+siaPath.String(), func() (interface{}, error) { return c.client.RenterDirGet(ctx, siaPath) })
+	rd, _ := v.(api.RenterDirectory)
+	return rd, err
+}
+
+// WalletGet implements apiClient.
+func (c *cachedClient) WalletGet(ctx context.Context) (api.WalletGET, error) {
+	v, err := c.get(ctx, "/wallet", "/wallet", func() (interface{}, error) { return c.client.WalletGet(ctx) })
+	wg, _ := v.(api.WalletGET)
+	return wg, err
+}
+
+// WalletAddressesGet implements apiClient.
+func (c *cachedClient) WalletAddressesGet(ctx context.Context) (api.WalletAddressesGET, error) {
+	v, err := c.get(ctx, "/wallet/addresses", "/wallet/addresses", func() (interface{}, error) { return c.client.WalletAddressesGet(ctx) })
+	wag, _ := v.(api.WalletAddressesGET)
+	return wag, err
+}
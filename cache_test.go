@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+	"gitlab.com/NebulousLabs/Sia/node/api"
+	"gitlab.com/NebulousLabs/errors"
+)
+
+// countingClient is an apiClient that counts the calls to the endpoints used
+// in the tests.
+type countingClient struct {
+	apiClient
+
+	consensusCalls int32
+	hostdbCalls    int32
+	hostdbErr      error
+	// release, if not nil, blocks HostDbAllGet until it is closed
+	release chan struct{}
+}
+
+func (c *countingClient) ConsensusGet(ctx context.Context) (api.ConsensusGET, error) {
+	atomic.AddInt32(&c.consensusCalls, 1)
+	return api.ConsensusGET{Height: 100}, nil
+}
+
+func (c *countingClient) HostDbAllGet(ctx context.Context) (api.HostdbAllGET, error) {
+	atomic.AddInt32(&c.hostdbCalls, 1)
+	if c.release != nil {
+		<-c.release
+	}
+	return api.HostdbAllGET{Hosts: make([]api.ExtendedHostDBEntry, 3)}, c.hostdbErr
+}
+
+func TestParseCacheTTLs(t *testing.T) {
+	ttls, err := parseCacheTTLs(defaultCacheTTLs)
+	if err != nil {
+		t.Fatalf("parseCacheTTLs(%q) failed: %v", defaultCacheTTLs, err)
+	}
+	if ttls["/hostdb/all"] != time.Minute {
+		t.Errorf("TTL of /hostdb/all was incorrect. expected %v got %v", time.Minute, ttls["/hostdb/all"])
+	}
+
+	ttls, err = parseCacheTTLs(" /consensus = 10s ,,")
+	if err != nil {
+		t.Fatalf("parseCacheTTLs failed: %v", err)
+	}
+	if len(ttls) != 1 || ttls["/consensus"] != 10*time.Second {
+		t.Errorf("parseCacheTTLs was incorrect. expected %v got %v", map[string]time.Duration{"/consensus": 10 * time.Second}, ttls)
+	}
+
+	for _, s := range []string{"/consensus", "/consensus=soon", "/explorer=1m"} {
+		if _, err := parseCacheTTLs(s); err == nil {
+			t.Errorf("parseCacheTTLs(%q) was incorrect. expected an error", s)
+		}
+	}
+}
+
+func TestCachedClient(t *testing.T) {
+	cc := &countingClient{}
+	c := newCachedClient(cc, map[string]time.Duration{"/consensus": time.Hour})
+
+	hits := testutil.ToFloat64(cacheRequests.WithLabelValues("/consensus", "hit"))
+	for i := 0; i < 3; i++ {
+		cg, err := c.ConsensusGet(context.Background())
+		if err != nil || cg.Height != 100 {
+			t.Fatalf("ConsensusGet was incorrect. expected height %v got %v (%v)", 100, cg.Height, err)
+		}
+	}
+	if n := atomic.LoadInt32(&cc.consensusCalls); n != 1 {
+		t.Errorf("number of /consensus calls was incorrect. expected %v got %v", 1, n)
+	}
+	if v := testutil.ToFloat64(cacheRequests.WithLabelValues("/consensus", "hit")) - hits; v != 2 {
+		t.Errorf("number of cache hits was incorrect. expected %v got %v", 2, v)
+	}
+
+	// Uncached endpoints and errors go through to the client every time
+	cc.hostdbErr = errors.New("hostdb unavailable")
+	for i := 0; i < 2; i++ {
+		if _, err := c.HostDbAllGet(context.Background()); err == nil {
+			t.Errorf("HostDbAllGet was incorrect. expected an error")
+		}
+	}
+	if n := atomic.LoadInt32(&cc.hostdbCalls); n != 2 {
+		t.Errorf("number of /hostdb/all calls was incorrect. expected %v got %v", 2, n)
+	}
+}
+
+func TestCacheHitsNotRecorded(t *testing.T) {
+	log = logrus.New()
+	cc := &countingClient{}
+	c := newCachedClient(recordingClient{client: cc}, map[string]time.Duration{"/consensus": time.Hour})
+
+	calls := testutil.ToFloat64(apiCalls.WithLabelValues("consensus", "/consensus"))
+	for i := 0; i < 3; i++ {
+		c.ConsensusGet(context.Background())
+	}
+	if v := testutil.ToFloat64(apiCalls.WithLabelValues("consensus", "/consensus")) - calls; v != 1 {
+		t.Errorf("number of recorded API calls was incorrect. expected %v got %v", 1, v)
+	}
+}
+
+func TestCachedClientExpiry(t *testing.T) {
+	cc := &countingClient{}
+	c := newCachedClient(cc, map[string]time.Duration{"/consensus": 10 * time.Millisecond})
+
+	c.ConsensusGet(context.Background())
+	time.Sleep(20 * time.Millisecond)
+	c.ConsensusGet(context.Background())
+	if n := atomic.LoadInt32(&cc.consensusCalls); n != 2 {
+		t.Errorf("number of /consensus calls was incorrect. expected %v got %v", 2, n)
+	}
+}
+
+func TestCachedClientDeduplication(t *testing.T) {
+	cc := &countingClient{release: make(chan struct{})}
+	c := newCachedClient(cc, nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			hdg, err := c.HostDbAllGet(context.Background())
+			if err != nil || len(hdg.Hosts) != 3 {
+				t.Errorf("HostDbAllGet was incorrect. expected %v hosts got %v (%v)", 3, len(hdg.Hosts), err)
+			}
+		}()
+	}
+	// Wait for the first request to reach the client before releasing it
+	for atomic.LoadInt32(&cc.hostdbCalls) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(cc.release)
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&cc.hostdbCalls); n != 1 {
+		t.Errorf("number of /hostdb/all calls was incorrect. expected %v got %v", 1, n)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// scrapeTimeoutHeader is the header in which Prometheus announces its scrape
+// timeout.
+const scrapeTimeoutHeader = "X-Prometheus-Scrape-Timeout-Seconds"
+
+var (
+	// collectConcurrency is the maximum number of modules collected at once.
+	collectConcurrency = 4
+	// moduleTimeout is how long the collection of a single module may take.
+	moduleTimeout = 30 * time.Second
+	// scrapeTimeoutOffset is subtracted from Prometheus' scrape timeout to
+	// leave time for serving the collected metrics.
+	scrapeTimeoutOffset = 500 * time.Millisecond
+)
+
+// moduleCollector is the metrics collection function of a Sia module.
+type moduleCollector struct {
+	name string
+	// flag is the letter that enables the collector in -modules. Collectors
+	// without a flag are always enabled.
+	flag string
+	// siadModule is the siad module the collector needs. Collectors without
+	// one work with any siad.
+	siadModule string
+	// help describes the metrics of the collector.
+	help    string
+	collect func(context.Context, apiClient) error
+}
+
+// moduleCollectors lists the metrics collection functions of all modules.
+var moduleCollectors = []moduleCollector{
+	{name: "daemon", help: "global rate limits", collect: daemonMetrics},
+	{name: "renter", flag: "r", siadModule: "renter", help: "renter files, allowance and contracts", collect: renterMetrics},
+	{name: "hostdb", flag: "r", siadModule: "renter", help: "hosts known to the renter", collect: hostdbMetrics},
+	{name: "consensus", flag: "c", siadModule: "consensus", help: "block height and sync state", collect: consensusMetrics},
+	{name: "wallet", flag: "w", siadModule: "wallet", help: "wallet balances and addresses", collect: walletMetrics},
+	{name: "gateway", flag: "g", siadModule: "gateway", help: "peers of the gateway", collect: gatewayMetrics},
+	{name: "host", flag: "h", siadModule: "host", help: "host settings, contracts and storage", collect: hostMetrics},
+}
+
+// enabledCollectors returns the collectors enabled by the -modules string,
+// unless enabled or disabled by name with -collector.<name> or
+// -no-collector.<name>.
+func enabledCollectors(modules string) []moduleCollector {
+	var enabled []moduleCollector
+	for _, c := range moduleCollectors {
+		if on, ok := collectorOverrides[c.name]; ok {
+			if on {
+				enabled = append(enabled, c)
+			}
+		} else if c.flag == "" || strings.Contains(modules, c.flag) {
+			enabled = append(enabled, c)
+		}
+	}
+	return enabled
+}
+
+// collect runs the collectors concurrently on at most collectConcurrency
+// workers. Every module gets moduleTimeout to finish, and modules that have
+// not finished when ctx is done are given up on, leaving the metrics of the
+// other modules in place. Collectors of modules siad did not load are skipped
+// and their metrics withheld. It returns the error of every module whose
+// collection failed by module name.
+func collect(ctx context.Context, sc apiClient, collectors []moduleCollector) map[string]error {
+	collectors = skipUnloaded(collectors)
+	workers := collectConcurrency
+	if workers > len(collectors) {
+		workers = len(collectors)
+	}
+	if workers < 1 {
+		workers = 1
+	}
+
+	work := make(chan moduleCollector)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	errs := make(map[string]error)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range work {
+				log.Debug("Updating ", c.name, " Metrics")
+				moduleCtx, cancel := context.WithTimeout(ctx, moduleTimeout)
+				if err := collectModule(moduleCtx, c.name, c.collect, sc); err != nil {
+					mu.Lock()
+					errs[c.name] = err
+					mu.Unlock()
+				}
+				cancel()
+			}
+		}()
+	}
+	for _, c := range collectors {
+		work <- c
+	}
+	close(work)
+	wg.Wait()
+	return errs
+}
+
+// scrapeTimeout returns how long a scrape may spend collecting metrics, which
+// is the scrape timeout announced by Prometheus minus scrapeTimeoutOffset. It
+// returns 0 if Prometheus did not announce a timeout.
+func scrapeTimeout(r *http.Request) time.Duration {
+	seconds, err := strconv.ParseFloat(r.Header.Get(scrapeTimeoutHeader), 64)
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+	timeout := time.Duration(seconds*float64(time.Second)) - scrapeTimeoutOffset
+	if timeout <= 0 {
+		// Leave at least a little time for collecting
+		timeout = time.Duration(seconds * float64(time.Second) / 2)
+	}
+	return timeout
+}
+
+// collectOnScrape wraps a metrics handler so that metrics are collected before
+// every scrape, within the scrape timeout announced by Prometheus. Only the
+// collectors selected by the collect[] query parameters are collected.
+func collectOnScrape(next http.Handler, sc apiClient) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if timeout := scrapeTimeout(r); timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		if collectors, err := requestedCollectors(r); err == nil {
+			updateMetrics(ctx, sc, collectors)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
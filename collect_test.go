@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+)
+
+func TestEnabledCollectors(t *testing.T) {
+	tests := []struct {
+		modules string
+		names   []string
+	}{
+		{"", []string{"daemon"}},
+		{"c", []string{"daemon", "consensus"}},
+		{"rw", []string{"daemon", "renter", "hostdb", "wallet"}},
+		{"cghmrtw", []string{"daemon", "renter", "hostdb", "consensus", "wallet", "gateway", "host"}},
+	}
+	for _, test := range tests {
+		collectors := enabledCollectors(test.modules)
+		var names []string
+		for _, c := range collectors {
+			names = append(names, c.name)
+		}
+		if len(names) != len(test.names) {
+			t.Errorf("enabledCollectors(%q) was incorrect. expected %v got %v", test.modules, test.names, names)
+			continue
+		}
+		for i := range names {
+			if names[i] != test.names[i] {
+				t.Errorf("enabledCollectors(%q) was incorrect. expected %v got %v", test.modules, test.names, names)
+				break
+			}
+		}
+	}
+}
+
+func TestCollectConcurrently(t *testing.T) {
+	log = logrus.New()
+	defer func(c int, d time.Duration) { collectConcurrency, moduleTimeout = c, d }(collectConcurrency, moduleTimeout)
+	collectConcurrency, moduleTimeout = 2, 100*time.Millisecond
+
+	var running, maxRunning int32
+	quick := func(context.Context, apiClient) error {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	}
+	hung := make(chan struct{})
+	defer close(hung)
+	hanging := func(context.Context, apiClient) error {
+		<-hung
+		return nil
+	}
+
+	collectors := []moduleCollector{
+		{name: "test_quick1", collect: quick},
+		{name: "test_hung", collect: hanging},
+		{name: "test_quick2", collect: quick},
+		{name: "test_quick3", collect: quick},
+	}
+	start := time.Now()
+	collect(context.Background(), nil, collectors)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("collect took too long. expected at most %v got %v", time.Second, elapsed)
+	}
+	if maxRunning > 2 {
+		t.Errorf("concurrent collections were incorrect. expected at most %v got %v", 2, maxRunning)
+	}
+
+	// The hung module failed, the others still produced results
+	for name, success := range map[string]float64{"test_quick1": 1, "test_hung": 0, "test_quick2": 1, "test_quick3": 1} {
+		if v := testutil.ToFloat64(scrapeSuccess.WithLabelValues(name)); v != success {
+			t.Errorf("scrape success of %v was incorrect. expected %v got %v", name, success, v)
+		}
+	}
+
+	// A module still being collected is not collected a second time
+	var calls int32
+	counting := func(context.Context, apiClient) error {
+		atomic.AddInt32(&calls, 1)
+		<-hung
+		return nil
+	}
+	collect(context.Background(), nil, []moduleCollector{{name: "test_counting", collect: counting}})
+	collect(context.Background(), nil, []moduleCollector{{name: "test_counting", collect: counting}})
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("number of collections was incorrect. expected %v got %v", 1, n)
+	}
+}
+
+func TestCollectAfterDeadline(t *testing.T) {
+	log = logrus.New()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	called := false
+	collect(ctx, nil, []moduleCollector{{name: "test_late", collect: func(context.Context, apiClient) error {
+		called = true
+		return nil
+	}}})
+	if called {
+		t.Errorf("collection was started after the deadline")
+	}
+	if v := testutil.ToFloat64(scrapeSuccess.WithLabelValues("test_late")); v != 0 {
+		t.Errorf("scrape success was incorrect. expected %v got %v", 0, v)
+	}
+}
+
+func TestScrapeTimeout(t *testing.T) {
+	defer func(d time.Duration) { scrapeTimeoutOffset = d }(scrapeTimeoutOffset)
+	scrapeTimeoutOffset = 500 * time.Millisecond
+
+	tests := []struct {
+		header  string
+		timeout time.Duration
+	}{
+		{"", 0},
+		{"garbage", 0},
+		{"-1", 0},
+		{"10", 9500 * time.Millisecond},
+		{"2.5", 2 * time.Second},
+		{"0.4", 200 * time.Millisecond},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/metrics", nil)
+		if test.header != "" {
+			r.Header.Set(scrapeTimeoutHeader, test.header)
+		}
+		if timeout := scrapeTimeout(r); timeout != test.timeout {
+			t.Errorf("scrapeTimeout(%q) was incorrect. expected %v got %v", test.header, test.timeout, timeout)
+		}
+	}
+}
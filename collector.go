@@ -1,11 +1,11 @@
 package main
 
 import (
+	"context"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"gitlab.com/NebulousLabs/Sia/modules"
 	"gitlab.com/NebulousLabs/Sia/node/api"
-	sia "gitlab.com/NebulousLabs/Sia/node/api/client"
 	"gitlab.com/NebulousLabs/errors"
 )
 
@@ -14,163 +14,174 @@ var (
 	// are not yet loaded.
 	ErrAPICallNotRecognized = errors.New("API call not recognized")
 
+	// errModuleNotLoaded is returned by the collectors of modules siad did not
+	// load, so that their metrics are withheld rather than exported as zeros.
+	errModuleNotLoaded = errors.New("module not loaded")
+
+	// Metric groups of the modules, so that the metrics of a module whose
+	// collection failed can be withheld
+	renterGroup    = newModuleMetrics("renter")
+	consensusGroup = newModuleMetrics("consensus")
+	daemonGroup    = newModuleMetrics("daemon")
+	walletGroup    = newModuleMetrics("wallet")
+	gatewayGroup   = newModuleMetrics("gateway")
+	hostdbGroup    = newModuleMetrics("hostdb")
+	hostGroup      = newModuleMetrics("host")
+
 	// Define the metrics we wish to expose
 	// Renter Metrics
-	renterModuleLoaded = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "renter_module_loaded", Help: "Is the renter module loaded. 0=not loaded.  1=loaded"})
-	renterAggregateNumFiles = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "renter_aggregate_num_files", Help: "Shows the number of files uploaded to Sia by the renter"})
-	renterAggregateNumStuckChunks = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "renter_aggregate_num_stuck_chunks", Help: "The aggregate number of stuck chunks"})
-	renterAggregateSize = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "renter_aggregate_size", Help: "The aggregate size of data stored on Sia"})
-	renterMaxHealth = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "renter_max_health", Help: "The max health"})
-	renterMaxHealthAggregatedPercentage = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "renter_max_health_aggregated_percentage", Help: "The max health aggregated in percentage"})
-	renterMinRedundancy = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "renter_min_redundancy", Help: "The min redundancy"})
-	renterMinRedundancyAggregated = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "renter_min_redundancy_aggregated", Help: "The min redundancy aggregated"})
-	renterRateLimitDownload = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "renter_rate_limit_download", Help: "renter download ratelimit (bytes-per-second)"})
-	renterRateLimitUpload = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "renter_rate_limit_upload", Help: "renter upload ratelimit (bytes-per-second)"})
+	renterAggregateNumFiles = promauto.With(renterGroup).NewGauge(prometheus.GaugeOpts{
+		Name: "sia_renter_aggregate_num_files", Help: "Shows the number of files uploaded to Sia by the renter"})
+	renterAggregateNumStuckChunks = promauto.With(renterGroup).NewGauge(prometheus.GaugeOpts{
+		Name: "sia_renter_aggregate_num_stuck_chunks", Help: "The aggregate number of stuck chunks"})
+	renterAggregateSize = promauto.With(renterGroup).NewGauge(prometheus.GaugeOpts{
+		Name: "sia_renter_aggregate_size_bytes", Help: "The aggregate size of data stored on Sia"})
+	renterMaxHealth = promauto.With(renterGroup).NewGauge(prometheus.GaugeOpts{
+		Name: "sia_renter_max_health", Help: "The max health"})
+	renterMaxHealthAggregatedPercentage = promauto.With(renterGroup).NewGauge(prometheus.GaugeOpts{
+		Name: "sia_renter_max_health_aggregated_percentage", Help: "The max health aggregated in percentage"})
+	renterMinRedundancy = promauto.With(renterGroup).NewGauge(prometheus.GaugeOpts{
+		Name: "sia_renter_min_redundancy", Help: "The min redundancy"})
+	renterMinRedundancyAggregated = promauto.With(renterGroup).NewGauge(prometheus.GaugeOpts{
+		Name: "sia_renter_min_redundancy_aggregated", Help: "The min redundancy aggregated"})
+	renterRateLimitDownload = promauto.With(renterGroup).NewGauge(prometheus.GaugeOpts{
+		Name: "sia_renter_rate_limit_download_bytes_per_second", Help: "renter download ratelimit (bytes-per-second)"})
+	renterRateLimitUpload = promauto.With(renterGroup).NewGauge(prometheus.GaugeOpts{
+		Name: "sia_renter_rate_limit_upload_bytes_per_second", Help: "renter upload ratelimit (bytes-per-second)"})
 	// Contracts
-	renterNumActiveContracts = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "renter_num_active_contracts", Help: "Number of active contracts"})
-	renterNumDisabledContracts = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "renter_num_disabled_contracts", Help: "Number of disabled contracts"})
-	renterNumRefreshedContracts = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "renter_num_refreshed_contracts", Help: "Number of refreshed contracts"})
-	renterNumPassiveContracts = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "renter_num_passive_contracts", Help: "Number of passive contracts"})
-	renterNumExpiredContracts = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "renter_num_expired_contracts", Help: "Number of expired contracts"})
-	renterNumExpiredRefreshedContracts = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "renter_num_expired_refreshed_contracts", Help: "Number of expired refreshed contracts"})
+	renterNumActiveContracts = promauto.With(renterGroup).NewGauge(prometheus.GaugeOpts{
+		Name: "sia_renter_num_active_contracts", Help: "Number of active contracts"})
+	renterNumDisabledContracts = promauto.With(renterGroup).NewGauge(prometheus.GaugeOpts{
+		Name: "sia_renter_num_disabled_contracts", Help: "Number of disabled contracts"})
+	renterNumRefreshedContracts = promauto.With(renterGroup).NewGauge(prometheus.GaugeOpts{
+		Name: "sia_renter_num_refreshed_contracts", Help: "Number of refreshed contracts"})
+	renterNumPassiveContracts = promauto.With(renterGroup).NewGauge(prometheus.GaugeOpts{
+		Name: "sia_renter_num_passive_contracts", Help: "Number of passive contracts"})
+	renterNumExpiredContracts = promauto.With(renterGroup).NewGauge(prometheus.GaugeOpts{
+		Name: "sia_renter_num_expired_contracts", Help: "Number of expired contracts"})
+	renterNumExpiredRefreshedContracts = promauto.With(renterGroup).NewGauge(prometheus.GaugeOpts{
+		Name: "sia_renter_num_expired_refreshed_contracts", Help: "Number of expired refreshed contracts"})
 	// Allowance
-	renterAllowanceAmount = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "renter_allowance_amount", Help: "Renter allowance Amount (siacoins)"})
-	renterAllowancePeriod = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "renter_allowance_period", Help: "Renter allowance period length (blocks)"})
-	renterAllowanceRenewWindow = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "renter_allowance_renew_window", Help: "Renter allowance renew window (blocks)"})
-	renterAllowanceHosts = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "renter_allowance_hosts", Help: "Renter allowance hosts"})
-	renterAllowanceCurrentSpent = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "renter_allowance_current_spent", Help: "Amount of allowance in Siacoins spent in the current period"})
-	renterAllowanceCurrentUnspent = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "renter_allowance_current_unspent", Help: "Unspent amount of allowance in Siacoins in the current period"})
-	renterAllowanceCurrentStorage = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "renter_allowance_current_storage", Help: "Amount of allowance in Siacoins spent in the current period on storage"})
-	renterAllowanceCurrentUpload = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "renter_allowance_current_upload", Help: "Amount of allowance in Siacoins spent in the current period on upload bandwidth"})
-	renterAllowanceCurrentDownload = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "renter_allowance_current_download", Help: "Amount of allowance in Siacoins spent in the current period on download bandwidth"})
-	renterAllowanceCurrentFees = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "renter_allowance_current_fees", Help: "Amount of allowance in Siacoins spent in the current period on fees"})
-	renterAllowanceCurrentUnspentAllocated = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "renter_allowance_current_unspent_allocated", Help: "Amount of allocated unspent allowance in Siacoins"})
-	renterAllowanceCurrentUnspentUnallocated = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "renter_allowance_current_unspent_unallocated", Help: "Amount of unallocated unspent allowance in Siacoins"})
+	renterAllowanceAmount = newSiacoinGauge(renterGroup, prometheus.GaugeOpts{
+		Name: "sia_renter_allowance_amount_siacoins", Help: "Renter allowance Amount (siacoins)"})
+	renterAllowancePeriod = promauto.With(renterGroup).NewGauge(prometheus.GaugeOpts{
+		Name: "sia_renter_allowance_period_blocks", Help: "Renter allowance period length (blocks)"})
+	renterAllowanceRenewWindow = promauto.With(renterGroup).NewGauge(prometheus.GaugeOpts{
+		Name: "sia_renter_allowance_renew_window_blocks", Help: "Renter allowance renew window (blocks)"})
+	renterAllowanceHosts = promauto.With(renterGroup).NewGauge(prometheus.GaugeOpts{
+		Name: "sia_renter_allowance_hosts", Help: "Renter allowance hosts"})
+	renterAllowanceCurrentSpent = newSiacoinGauge(renterGroup, prometheus.GaugeOpts{
+		Name: "sia_renter_allowance_current_spent_siacoins", Help: "Amount of allowance in Siacoins spent in the current period"})
+	renterAllowanceCurrentUnspent = newSiacoinGauge(renterGroup, prometheus.GaugeOpts{
+		Name: "sia_renter_allowance_current_unspent_siacoins", Help: "Unspent amount of allowance in Siacoins in the current period"})
+	renterAllowanceCurrentStorage = newSiacoinGauge(renterGroup, prometheus.GaugeOpts{
+		Name: "sia_renter_allowance_current_storage_siacoins", Help: "Amount of allowance in Siacoins spent in the current period on storage"})
+	renterAllowanceCurrentUpload = newSiacoinGauge(renterGroup, prometheus.GaugeOpts{
+		Name: "sia_renter_allowance_current_upload_siacoins", Help: "Amount of allowance in Siacoins spent in the current period on upload bandwidth"})
+	renterAllowanceCurrentDownload = newSiacoinGauge(renterGroup, prometheus.GaugeOpts{
+		Name: "sia_renter_allowance_current_download_siacoins", Help: "Amount of allowance in Siacoins spent in the current period on download bandwidth"})
+	renterAllowanceCurrentFees = newSiacoinGauge(renterGroup, prometheus.GaugeOpts{
+		Name: "sia_renter_allowance_current_fees_siacoins", Help: "Amount of allowance in Siacoins spent in the current period on fees"})
+	renterAllowanceCurrentUnspentAllocated = newSiacoinGauge(renterGroup, prometheus.GaugeOpts{
+		Name: "sia_renter_allowance_current_unspent_allocated_siacoins", Help: "Amount of allocated unspent allowance in Siacoins"})
+	renterAllowanceCurrentUnspentUnallocated = newSiacoinGauge(renterGroup, prometheus.GaugeOpts{
+		Name: "sia_renter_allowance_current_unspent_unallocated_siacoins", Help: "Amount of unallocated unspent allowance in Siacoins"})
 
 	// Consensus Metrics
-	consensusModuleLoaded = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "consensus_module_loaded", Help: "Is the consensus module loaded. 0=not loaded.  1=loaded"})
-	consensusSynced = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "consensus_synced", Help: "Consensus sync status, 0=not synced.  1=synced"})
-	consensusHeight = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "consensus_height", Help: "Consensus block height"})
-	consensusDifficulty = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "consensus_difficulty", Help: "Consensus difficulty"})
+	consensusSynced = promauto.With(consensusGroup).NewGauge(prometheus.GaugeOpts{
+		Name: "sia_consensus_synced", Help: "Consensus sync status, 0=not synced.  1=synced"})
+	consensusHeight = promauto.With(consensusGroup).NewGauge(prometheus.GaugeOpts{
+		Name: "sia_consensus_height", Help: "Consensus block height"})
+	consensusDifficulty = promauto.With(consensusGroup).NewGauge(prometheus.GaugeOpts{
+		Name: "sia_consensus_difficulty", Help: "Consensus difficulty"})
 
 	// Daemon Metrics
-	//	daemonAggregateNumAlerts = promauto.NewGauge(prometheus.GaugeOpts{
+	//	daemonAggregateNumAlerts = promauto.With(daemonGroup).NewGauge(prometheus.GaugeOpts{
 	//		Name: "daemon_aggregate_num_alerts", Help: "Total number of daemon Alerts"})
-	daemonRateLimitDownload = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "global_rate_limit_download", Help: "global download ratelimit (bytes-per-second)"})
-	daemonRateLimitUpload = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "global_rate_limit_upload", Help: "global upload ratelimit (bytes-per-second)"})
+	daemonRateLimitDownload = promauto.With(daemonGroup).NewGauge(prometheus.GaugeOpts{
+		Name: "sia_global_rate_limit_download_bytes_per_second", Help: "global download ratelimit (bytes-per-second)"})
+	daemonRateLimitUpload = promauto.With(daemonGroup).NewGauge(prometheus.GaugeOpts{
+		Name: "sia_global_rate_limit_upload_bytes_per_second", Help: "global upload ratelimit (bytes-per-second)"})
 
 	// Wallet Metrics
-	walletModuleLoaded = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "wallet_module_loaded", Help: "Is the wallet module loaded. 0=not loaded.  1=loaded"})
-	walletLocked = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "wallet_locked", Help: "Is the wallet locked. 0=not locked.  1=locked"})
-	walletConfirmedSiacoinBalanceHastings = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "wallet_confirmed_siacoin_balance_hastings", Help: "Wallet confirmed Siacoin balance (Hastings)"})
-	walletConfirmedSiacoinBalance = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "wallet_confirmed_siacoin_balance", Help: "Wallet confirmed Siacoin balance (Siacoins)"})
-	walletSiafundBalance = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "wallet_siafund_balance", Help: "Wallet Siafund balance"})
-	walletSiafundClaimBalance = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "wallet_siafund_claim_balance", Help: "Wallet Siafund claim balance"})
-	walletNumAddresses = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "wallet_num_addresses", Help: "Number of wallet addresses being tracked by Sia"})
+	walletLocked = promauto.With(walletGroup).NewGauge(prometheus.GaugeOpts{
+		Name: "sia_wallet_locked", Help: "Is the wallet locked. 0=not locked.  1=locked"})
+	walletConfirmedSiacoinBalanceHastings = promauto.With(walletGroup).NewGauge(prometheus.GaugeOpts{
+		Name: "sia_wallet_confirmed_siacoin_balance_hastings", Help: "Wallet confirmed Siacoin balance (Hastings)"})
+	walletConfirmedSiacoinBalance = newSiacoinGauge(walletGroup, prometheus.GaugeOpts{
+		Name: "sia_wallet_confirmed_siacoin_balance_siacoins", Help: "Wallet confirmed Siacoin balance (Siacoins)"})
+	walletSiafundBalance = promauto.With(walletGroup).NewGauge(prometheus.GaugeOpts{
+		Name: "sia_wallet_siafund_balance", Help: "Wallet Siafund balance"})
+	walletSiafundClaimBalance = promauto.With(walletGroup).NewGauge(prometheus.GaugeOpts{
+		Name: "sia_wallet_siafund_claim_balance_hastings", Help: "Wallet Siafund claim balance"})
+	walletNumAddresses = promauto.With(walletGroup).NewGauge(prometheus.GaugeOpts{
+		Name: "sia_wallet_num_addresses", Help: "Number of wallet addresses being tracked by Sia"})
 
 	// Gateway Metrics
-	gatewayModuleLoaded = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "gateway_module_loaded", Help: "Is the gateway module loaded. 0=not loaded.  1=loaded"})
-	gatewayNumPeers = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "gateway_num_peers", Help: "gateway number of peers"})
-	gatewayRateLimitDownload = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "gateway_rate_limit_download", Help: "gateway download ratelimit (bytes-per-second)"})
-	gatewayRateLimitUpload = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "gateway_rate_limit_upload", Help: "gateway upload ratelimit (bytes-per-second)"})
+	gatewayNumPeers = promauto.With(gatewayGroup).NewGauge(prometheus.GaugeOpts{
+		Name: "sia_gateway_num_peers", Help: "gateway number of peers"})
+	gatewayRateLimitDownload = promauto.With(gatewayGroup).NewGauge(prometheus.GaugeOpts{
+		Name: "sia_gateway_rate_limit_download_bytes_per_second", Help: "gateway download ratelimit (bytes-per-second)"})
+	gatewayRateLimitUpload = promauto.With(gatewayGroup).NewGauge(prometheus.GaugeOpts{
+		Name: "sia_gateway_rate_limit_upload_bytes_per_second", Help: "gateway upload ratelimit (bytes-per-second)"})
 
 	// Hostdb Metrics
-	hostdbNumAllHosts = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "hostdb_num_all_hosts", Help: "Total number of hosts in hostdb"})
-	hostdbNumActiveHosts = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "hostdb_num_active_hosts", Help: "Number of active hosts in hostdb"})
-	hostdbNumInactiveHosts = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "hostdb_num_inactive_hosts", Help: "Number of inactive hosts in hostdb"})
-	hostdbNumOfflineHosts = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "hostdb_num_offline_hosts", Help: "Number of offline hosts in hostdb"})
+	hostdbNumAllHosts = promauto.With(hostdbGroup).NewGauge(prometheus.GaugeOpts{
+		Name: "sia_hostdb_num_all_hosts", Help: "Total number of hosts in hostdb"})
+	hostdbNumActiveHosts = promauto.With(hostdbGroup).NewGauge(prometheus.GaugeOpts{
+		Name: "sia_hostdb_num_active_hosts", Help: "Number of active hosts in hostdb"})
+	hostdbNumInactiveHosts = promauto.With(hostdbGroup).NewGauge(prometheus.GaugeOpts{
+		Name: "sia_hostdb_num_inactive_hosts", Help: "Number of inactive hosts in hostdb"})
+	hostdbNumOfflineHosts = promauto.With(hostdbGroup).NewGauge(prometheus.GaugeOpts{
+		Name: "sia_hostdb_num_offline_hosts", Help: "Number of offline hosts in hostdb"})
 
 	// Host Metrics
-	hostAcceptingContracts = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "host_accepting_contracts", Help: "Is the host accepting contracts 0=no, 1=yes"})
-	hostMaxDuration = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "host_max_duration", Help: "max duration in weeks"})
-	hostMaxDownloadBatchSize = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "host_max_download_batch_size", Help: "Max Download Batch Size"})
-	hostMaxReviseBatchSize = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "host_max_revise_batch_size", Help: "Max revise Batch Size"})
-	hostWindowSize = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "host_window_size", Help: "Window Size in hours"})
-	hostCollateral = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "host_collateral", Help: "Host Collateral in Siacoins"})
-	hostCollateralBudget = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "host_collateral_budget", Help: "Host Collateral budget in Siacoins"})
-	hostMaxCollateral = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "host_max_collateral", Help: "Max collateral per contract"})
-	hostContractCount = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "host_contract_count", Help: "number of host contracts"})
-	hostTotalStorage = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "host_total_storage", Help: "total amount of storage available on the host in bytes"})
-	hostRemainingStorage = promauto.NewGauge(prometheus.GaugeOpts{
-		Name: "host_remaining_storage", Help: "amount of storage remaining on the host in bytes"})
+	hostAcceptingContracts = promauto.With(hostGroup).NewGauge(prometheus.GaugeOpts{
+		Name: "sia_host_accepting_contracts", Help: "Is the host accepting contracts 0=no, 1=yes"})
+	hostMaxDuration = promauto.With(hostGroup).NewGauge(prometheus.GaugeOpts{
+		Name: "sia_host_max_duration_blocks", Help: "Max contract duration (blocks)"})
+	hostMaxDownloadBatchSize = promauto.With(hostGroup).NewGauge(prometheus.GaugeOpts{
+		Name: "sia_host_max_download_batch_size_bytes", Help: "Max Download Batch Size"})
+	hostMaxReviseBatchSize = promauto.With(hostGroup).NewGauge(prometheus.GaugeOpts{
+		Name: "sia_host_max_revise_batch_size_bytes", Help: "Max revise Batch Size"})
+	hostWindowSize = promauto.With(hostGroup).NewGauge(prometheus.GaugeOpts{
+		Name: "sia_host_window_size_blocks", Help: "Window size (blocks)"})
+	hostCollateral = newSiacoinGauge(hostGroup, prometheus.GaugeOpts{
+		Name: "sia_host_collateral_per_tb_month_siacoins", Help: "Host Collateral in Siacoins per TB per month"})
+	hostCollateralBudget = newSiacoinGauge(hostGroup, prometheus.GaugeOpts{
+		Name: "sia_host_collateral_budget_siacoins", Help: "Host Collateral budget in Siacoins"})
+	hostMaxCollateral = newSiacoinGauge(hostGroup, prometheus.GaugeOpts{
+		Name: "sia_host_max_collateral_siacoins", Help: "Max collateral per contract"})
+	hostRevenue = newSiacoinGauge(hostGroup, prometheus.GaugeOpts{
+		Name: "sia_host_revenue_siacoins", Help: "Host revenue earned in Siacoins"})
+	hostPotentialRevenue = newSiacoinGauge(hostGroup, prometheus.GaugeOpts{
+		Name: "sia_host_potential_revenue_siacoins", Help: "Host revenue not yet earned from active contracts in Siacoins"})
+	hostContractCount = promauto.With(hostGroup).NewGauge(prometheus.GaugeOpts{
+		Name: "sia_host_contract_count", Help: "number of host contracts"})
+	hostTotalStorage = promauto.With(hostGroup).NewGauge(prometheus.GaugeOpts{
+		Name: "sia_host_total_storage_bytes", Help: "total amount of storage available on the host in bytes"})
+	hostRemainingStorage = promauto.With(hostGroup).NewGauge(prometheus.GaugeOpts{
+		Name: "sia_host_remaining_storage_bytes", Help: "amount of storage remaining on the host in bytes"})
 )
 
 const (
 	moduleNotReadyStatus = "Module not loaded or still starting up"
 )
 
-func hostMetrics(sc *sia.Client) {
-	hg, err := sc.HostGet()
+// hostMetrics retrieves and sets the Prometheus metrics related to the
+// Sia host
+func hostMetrics(ctx context.Context, sc apiClient) error {
+	hg, err := sc.HostGet(ctx)
 	if errors.Contains(err, ErrAPICallNotRecognized) {
 		// Assume module is not loaded if status command is not recognized.
-		log.Info("Host module is not loaded")
-		return
+		return errModuleNotLoaded
 	} else if err != nil {
-		log.Info("Could not fetch host settings")
+		return err
 	}
 
-	sg, err := sc.HostStorageGet()
+	sg, err := sc.HostStorageGet(ctx)
 	if err != nil {
-		log.Info("Could not fetch storage info")
+		return err
 	}
 
 	es := hg.ExternalSettings
@@ -188,14 +199,14 @@ func hostMetrics(sc *sia.Client) {
 	// convert price from bytes/block to TB/Month
 	//	price := is.MinStoragePrice.Mul(modules.BlockBytesPerMonthTerabyte)
 	// calculate total revenue
-	//	totalRevenue := fm.ContractCompensation.
-	//		Add(fm.StorageRevenue).
-	//		Add(fm.DownloadBandwidthRevenue).
-	//		Add(fm.UploadBandwidthRevenue)
-	//	totalPotentialRevenue := fm.PotentialContractCompensation.
-	//		Add(fm.PotentialStorageRevenue).
-	//		Add(fm.PotentialDownloadBandwidthRevenue).
-	//		Add(fm.PotentialUploadBandwidthRevenue)
+	totalRevenue := fm.ContractCompensation.
+		Add(fm.StorageRevenue).
+		Add(fm.DownloadBandwidthRevenue).
+		Add(fm.UploadBandwidthRevenue)
+	totalPotentialRevenue := fm.PotentialContractCompensation.
+		Add(fm.PotentialStorageRevenue).
+		Add(fm.PotentialDownloadBandwidthRevenue).
+		Add(fm.PotentialUploadBandwidthRevenue)
 
 	// Host Internal Settings
 	hostAcceptingContracts.Set(boolToFloat64(is.AcceptingContracts))
@@ -204,7 +215,7 @@ func hostMetrics(sc *sia.Client) {
 	hostMaxDuration.Set(float64(is.MaxDuration))
 	hostMaxDownloadBatchSize.Set(float64(is.MaxDownloadBatchSize))
 	hostMaxReviseBatchSize.Set(float64(is.MaxReviseBatchSize))
-	hostWindowSize.Set(float64(is.WindowSize / 6))
+	hostWindowSize.Set(float64(is.WindowSize))
 	hostCollateralFloat, _ := is.Collateral.Mul(modules.BlockBytesPerMonthTerabyte).Float64()
 	hostCollateral.Set(hostCollateralFloat / 1e24)
 	hostCollateralBudgetFloat, _ := is.CollateralBudget.Float64()
@@ -213,23 +224,40 @@ func hostMetrics(sc *sia.Client) {
 	hostMaxCollateral.Set(hostMaxCollateralFloat / 1e24)
 
 	hostContractCount.Set(float64(fm.ContractCount))
+	totalRevenueFloat, _ := totalRevenue.Float64()
+	hostRevenue.Set(totalRevenueFloat / 1e24)
+	totalPotentialRevenueFloat, _ := totalPotentialRevenue.Float64()
+	hostPotentialRevenue.Set(totalPotentialRevenueFloat / 1e24)
 
+	return nil
 }
 
-func renterMetrics(sc *sia.Client) {
+// renterMetrics retrieves and sets the Prometheus metrics related to the
+// Sia renter
+func renterMetrics(ctx context.Context, sc apiClient) error {
 
 	// Renter Get Dir Metrics
-	rg, err := sc.RenterDirGet(modules.RootSiaPath())
+	rg, err := sc.RenterDirGet(ctx, modules.RootSiaPath())
 	if errors.Contains(err, ErrAPICallNotRecognized) {
-		log.Info("Renter module is not loaded")
-		renterModuleLoaded.Set(boolToFloat64(false))
-		return
+		return errModuleNotLoaded
 	} else if err != nil {
-		log.Info("Could not get Renter metrics")
-		return
+		return err
+	} else if len(rg.Directories) == 0 {
+		return errors.New("siad listed no root directory")
+	}
+
+	// Contract Metrics
+	rc, err := sc.RenterDisabledContractsGet(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Allowance Metrics
+	ra, err := sc.RenterGet(ctx)
+	if err != nil {
+		return err
 	}
 
-	renterModuleLoaded.Set(boolToFloat64(true))
 	renterAggregateNumFiles.Set(float64(rg.Directories[0].AggregateNumFiles))
 	renterAggregateNumStuckChunks.Set(float64(rg.Directories[0].AggregateNumStuckChunks))
 	renterAggregateSize.Set(float64(rg.Directories[0].AggregateSize))
@@ -238,28 +266,13 @@ func renterMetrics(sc *sia.Client) {
 	renterMinRedundancy.Set(float64(rg.Directories[0].MinRedundancy))
 	renterMinRedundancyAggregated.Set(float64(rg.Directories[0].AggregateMinRedundancy))
 
-	// Contract Metrics
-	rc, err := sc.RenterDisabledContractsGet()
-	if err != nil {
-		log.Info("Could not get renter contracts")
-	}
 	renterNumActiveContracts.Set(float64(len(rc.ActiveContracts)))
 	renterNumPassiveContracts.Set(float64(len(rc.PassiveContracts)))
 	renterNumRefreshedContracts.Set(float64(len(rc.RefreshedContracts)))
 	renterNumDisabledContracts.Set(float64(len(rc.DisabledContracts)))
+	renterNumExpiredContracts.Set(float64(len(rc.ExpiredContracts)))
+	renterNumExpiredRefreshedContracts.Set(float64(len(rc.ExpiredRefreshedContracts)))
 
-	rce, err := sc.RenterDisabledContractsGet()
-	if err != nil {
-		log.Info("Could not get renter expired contracts")
-	}
-	renterNumExpiredContracts.Set(float64(len(rce.ExpiredContracts)))
-	renterNumExpiredRefreshedContracts.Set(float64(len(rce.ExpiredRefreshedContracts)))
-
-	// Allowance Metrics
-	ra, err := sc.RenterGet()
-	if err != nil {
-		log.Info("Could not get renter allowance info")
-	}
 	allowance := ra.Settings.Allowance
 	funds, _ := allowance.Funds.Float64()
 	renterAllowanceAmount.Set(float64(funds / 1e24))
@@ -289,31 +302,29 @@ func renterMetrics(sc *sia.Client) {
 	renterRateLimitUpload.Set(float64(ra.Settings.MaxUploadSpeed))
 	renterRateLimitDownload.Set(float64(ra.Settings.MaxDownloadSpeed))
 
+	return nil
 }
 
 // consensuMetrics retrieves and sets the Prometheus metrics related to the
 // consensus module
-func consensusMetrics(sc *sia.Client) {
-	cs, err := sc.ConsensusGet()
+func consensusMetrics(ctx context.Context, sc apiClient) error {
+	cs, err := sc.ConsensusGet(ctx)
 	if errors.Contains(err, ErrAPICallNotRecognized) {
-		log.Info("Consensus module is not loaded")
-		consensusModuleLoaded.Set(boolToFloat64(false))
-		return
+		return errModuleNotLoaded
 	} else if err != nil {
-		log.Info("Could not get Consensus metrics")
-		return
+		return err
 	}
 
-	consensusModuleLoaded.Set(boolToFloat64(true))
 	consensusSynced.Set(boolToFloat64(cs.Synced))
 	consensusHeight.Set(float64(cs.Height))
 	Difficulty, _ := cs.Difficulty.Float64()
 	consensusDifficulty.Set(Difficulty)
+	return nil
 }
 
 // daemonMetrics retrieves and sets the Prometheus metrics related to the
 // Sia daemon
-func daemonMetrics(sc *sia.Client) {
+func daemonMetrics(ctx context.Context, sc apiClient) error {
 	//al, err := sc.DaemonAlertsGet()
 	//if err != nil {
 	//	log.Info("Could not get Daemon metrics")
@@ -322,33 +333,39 @@ func daemonMetrics(sc *sia.Client) {
 	//daemonAggregateNumAlerts.Set(float64(len(al.Alerts)))
 
 	// Global Daemon Rate Limits
-	dg, err := sc.DaemonSettingsGet()
+	dg, err := sc.DaemonSettingsGet(ctx)
 	if err != nil {
-		log.Info("Could not get daemon metrics")
-		return
+		return err
 	}
 	daemonRateLimitUpload.Set(float64(dg.MaxUploadSpeed))
 	daemonRateLimitDownload.Set(float64(dg.MaxDownloadSpeed))
 
+	return nil
 }
 
 // walletMetrics retrieves and sets the Prometheus metrics related to the
 // Sia wallet
-func walletMetrics(sc *sia.Client) {
-	status, err := sc.WalletGet()
+func walletMetrics(ctx context.Context, sc apiClient) error {
+	status, err := sc.WalletGet(ctx)
 	if errors.Contains(err, ErrAPICallNotRecognized) {
-		log.Info("Wallet module is not loaded")
-		walletModuleLoaded.Set(boolToFloat64(false))
-		return
+		return errModuleNotLoaded
 	} else if err != nil {
-		log.Info("Could not get Wallet metrics")
-		return
+		return err
 	}
-	walletModuleLoaded.Set(boolToFloat64(true))
+
+	// A locked wallet reports no balances and refuses to list its addresses,
+	// so keep the last values of those until it is unlocked again
 	if !status.Unlocked {
-		walletLocked.Set(boolToFloat64(false))
+		walletLocked.Set(boolToFloat64(true))
+		return nil
 	}
-	walletLocked.Set(boolToFloat64(true))
+
+	addresses, err := sc.WalletAddressesGet(ctx)
+	if err != nil {
+		return err
+	}
+
+	walletLocked.Set(boolToFloat64(false))
 
 	ConfirmedBalance, _ := status.ConfirmedSiacoinBalance.Float64()
 	walletConfirmedSiacoinBalanceHastings.Set(ConfirmedBalance)
@@ -360,42 +377,34 @@ func walletMetrics(sc *sia.Client) {
 	SiafundClaimBalance, _ := status.SiacoinClaimBalance.Float64()
 	walletSiafundClaimBalance.Set(SiafundClaimBalance)
 
-	addresses, err := sc.WalletAddressesGet()
-	if err != nil {
-		log.Info("Could not get wallet addresses")
-	}
 	walletNumAddresses.Set(float64(len(addresses.Addresses)))
+	return nil
 }
 
 // gatewayMetrics retrieves and sets the Prometheus metrics related to the
 // Sia gateway
-func gatewayMetrics(sc *sia.Client) {
-	gateway, err := sc.GatewayGet()
+func gatewayMetrics(ctx context.Context, sc apiClient) error {
+	gateway, err := sc.GatewayGet(ctx)
 	if errors.Contains(err, ErrAPICallNotRecognized) {
-		log.Info("Gateway module is not loaded")
-		gatewayModuleLoaded.Set(boolToFloat64(false))
-		return
+		return errModuleNotLoaded
 	} else if err != nil {
-		log.Info("Could not get Gateway metrics")
-		return
+		return err
 	}
 
-	gatewayModuleLoaded.Set(boolToFloat64(true))
 	gatewayNumPeers.Set(float64(len(gateway.Peers)))
 	gatewayRateLimitUpload.Set(float64(gateway.MaxUploadSpeed))
 	gatewayRateLimitDownload.Set(float64(gateway.MaxDownloadSpeed))
+	return nil
 }
 
 // hostdbMetrics retrieves and sets the Prometheus metrics related to the
 // Sia hostdb
-func hostdbMetrics(sc *sia.Client) {
-	hostdb, err := sc.HostDbAllGet()
+func hostdbMetrics(ctx context.Context, sc apiClient) error {
+	hostdb, err := sc.HostDbAllGet(ctx)
 	if errors.Contains(err, ErrAPICallNotRecognized) {
-		log.Info("HostDB module is not loaded")
-		return
+		return errModuleNotLoaded
 	} else if err != nil {
-		log.Info("Could not get Gateway metrics")
-		return
+		return err
 	}
 
 	// Iterate through the hosts and divide by category.
@@ -416,4 +425,5 @@ func hostdbMetrics(sc *sia.Client) {
 	hostdbNumActiveHosts.Set(float64(len(activeHosts)))
 	hostdbNumInactiveHosts.Set(float64(len(inactiveHosts)))
 	hostdbNumOfflineHosts.Set(float64(len(offlineHosts)))
+	return nil
 }
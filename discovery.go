@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+	"gitlab.com/NebulousLabs/Sia/node/api"
+)
+
+var (
+	moduleLoaded = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "sia_module_loaded", Help: "Is the module loaded according to siad. 0=not loaded.  1=loaded"}, []string{"module"})
+
+	loadedMu sync.Mutex
+	// loadedModules holds whether siad loaded a module by module name. It is
+	// nil until siad reported its modules.
+	loadedModules map[string]bool
+	// separateModules holds the modules served by a siad of their own, see
+	// moduleClient, which the modules of the main siad do not apply to.
+	separateModules map[string]bool
+)
+
+// siadModules returns whether siad loaded a module by module name, or nil if
+// siad does not report its modules, as older versions of siad don't.
+func siadModules(dg api.DaemonSettingsGet) map[string]bool {
+	m := dg.Modules
+	loaded := map[string]bool{
+		"consensus":       m.Consensus,
+		"explorer":        m.Explorer,
+		"feemanager":      m.FeeManager,
+		"gateway":         m.Gateway,
+		"host":            m.Host,
+		"miner":           m.Miner,
+		"renter":          m.Renter,
+		"transactionpool": m.TransactionPool,
+		"wallet":          m.Wallet,
+	}
+	for _, l := range loaded {
+		if l {
+			return loaded
+		}
+	}
+	return nil
+}
+
+// moduleList returns the names of the loaded modules, sorted.
+func moduleList(loaded map[string]bool) string {
+	var names []string
+	for name, l := range loaded {
+		if l {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// setLoadedModules records and exports the modules siad loaded.
+func setLoadedModules(loaded map[string]bool) {
+	if loaded == nil {
+		return
+	}
+	loadedMu.Lock()
+	defer loadedMu.Unlock()
+	if loadedModules == nil {
+		log.Info("siad loaded the modules: ", moduleList(loaded))
+	} else if moduleList(loaded) != moduleList(loadedModules) {
+		log.Info("siad's loaded modules changed from ", moduleList(loadedModules), " to ", moduleList(loaded))
+	}
+	loadedModules = loaded
+	for name, l := range loaded {
+		moduleLoaded.WithLabelValues(name).Set(boolToFloat64(l))
+	}
+}
+
+// discoverModules asks siad which modules it loaded, so that only their
+// collectors are run. It is called before every refresh, whichever collectors
+// are due, so that a siad restarted with other modules is noticed. While siad
+// cannot be asked the last known modules are kept.
+func discoverModules(ctx context.Context, sc apiClient) {
+	entry := log.WithField("endpoint", "/daemon/settings")
+	dg, err := sc.DaemonSettingsGet(ctx)
+	if err != nil {
+		repeats.log("discovery", entry.WithError(err), logrus.WarnLevel, "Could not discover siad's modules")
+		return
+	}
+	loaded := siadModules(dg)
+	if loaded == nil {
+		repeats.log("discovery", entry, logrus.InfoLevel, "siad does not report its modules, collecting all enabled modules")
+		return
+	}
+	repeats.resolve("discovery", entry, "Discovered siad's modules again")
+	setLoadedModules(loaded)
+}
+
+// isLoaded returns whether siad loaded the module of a collector. It is true
+// for every collector while siad's modules are unknown, and for the modules
+// served by a siad of their own.
+func isLoaded(c moduleCollector) bool {
+	loadedMu.Lock()
+	defer loadedMu.Unlock()
+	return loadedModules == nil || c.siadModule == "" || loadedModules[c.siadModule] || separateModules[c.siadModule]
+}
+
+// loadedCollectors returns the collectors whose module siad loaded.
+func loadedCollectors(collectors []moduleCollector) []moduleCollector {
+	var loaded []moduleCollector
+	for _, c := range collectors {
+		if isLoaded(c) {
+			loaded = append(loaded, c)
+		}
+	}
+	return loaded
+}
+
+// skipUnloaded returns the collectors whose module siad loaded, and withholds
+// the metrics of the others, e.g. after siad restarted without their module,
+// until they are collected again.
+func skipUnloaded(collectors []moduleCollector) []moduleCollector {
+	var loaded []moduleCollector
+	for _, c := range collectors {
+		if isLoaded(c) {
+			loaded = append(loaded, c)
+		} else if g, ok := moduleGroups[c.name]; ok {
+			g.reset()
+		}
+	}
+	return loaded
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+	"gitlab.com/NebulousLabs/Sia/node/api"
+)
+
+func TestSiadModules(t *testing.T) {
+	if loaded := siadModules(api.DaemonSettingsGet{}); loaded != nil {
+		t.Errorf("modules were incorrect. expected nil for a siad not reporting them got %v", loaded)
+	}
+	var dg api.DaemonSettingsGet
+	dg.Modules.Consensus, dg.Modules.Renter = true, true
+	loaded := siadModules(dg)
+	if expected := "consensus, renter"; moduleList(loaded) != expected {
+		t.Errorf("modules were incorrect. expected %v got %v", expected, moduleList(loaded))
+	}
+}
+
+func TestModuleDiscovery(t *testing.T) {
+	log = logrus.New()
+	log.SetOutput(ioutil.Discard)
+	defer func() { loadedModules = nil }()
+
+	siad := newFakeSiad(scenarioDir("default"))
+	defer siad.Close()
+	resetAllModuleMetrics()
+	discoverModules(context.Background(), fakeClient(siad.URL))
+	for module, expected := range map[string]float64{"renter": 1, "wallet": 1, "miner": 0} {
+		if v := testutil.ToFloat64(moduleLoaded.WithLabelValues(module)); v != expected {
+			t.Errorf("sia_module_loaded of %v was incorrect. expected %v got %v", module, expected, v)
+		}
+	}
+	collect(context.Background(), fakeClient(siad.URL), moduleCollectors)
+	if !renterGroup.exported() || !hostdbGroup.exported() {
+		t.Fatalf("renter metrics were incorrect. expected them to be exported")
+	}
+
+	// siad restarted without the renter
+	setLoadedModules(map[string]bool{"consensus": true, "gateway": true, "wallet": true})
+	var names []string
+	for _, c := range loadedCollectors(moduleCollectors) {
+		names = append(names, c.name)
+	}
+	if len(names) != 4 {
+		t.Errorf("loaded collectors were incorrect. expected daemon, consensus, wallet and gateway got %v", names)
+	}
+	errs := collect(context.Background(), fakeClient(siad.URL), moduleCollectors)
+	if len(errs) != 0 {
+		t.Errorf("collection was incorrect. expected no errors got %v", errs)
+	}
+	if renterGroup.exported() || hostdbGroup.exported() || hostGroup.exported() {
+		t.Errorf("metrics of unloaded modules were incorrect. expected them to be withheld")
+	}
+	if !walletGroup.exported() {
+		t.Errorf("wallet metrics were incorrect. expected them to be exported")
+	}
+}
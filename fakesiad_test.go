@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/expfmt"
+	"github.com/sirupsen/logrus"
+)
+
+var update = flag.Bool("update", false, "update the expected metrics of the scenarios in testdata")
+
+// fakeSiad is a fake siad serving the fixtures of a scenario. Its endpoints
+// can be made to fail and it can require an API password.
+type fakeSiad struct {
+	*httptest.Server
+	fixtures fixtureServer
+
+	mu       sync.Mutex
+	failing  map[string]bool
+	password string
+}
+
+// newFakeSiad starts a fake siad serving the fixtures of dirs.
+func newFakeSiad(dirs ...string) *fakeSiad {
+	s := &fakeSiad{fixtures: fixtureServer{dirs: dirs}, failing: make(map[string]bool)}
+	s.Server = httptest.NewServer(s)
+	return s
+}
+
+func (s *fakeSiad) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	password, failing := s.password, s.failing[r.URL.Path]
+	s.mu.Unlock()
+	if _, pw, _ := r.BasicAuth(); password != "" && pw != password {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"message": "API authentication failed."}`)
+		return
+	}
+	if failing {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, `{"message": "internal error"}`)
+		return
+	}
+	s.fixtures.ServeHTTP(w, r)
+}
+
+// setFailing makes the endpoint at path fail, or serve its fixture again.
+func (s *fakeSiad) setFailing(path string, failing bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failing[path] = failing
+}
+
+// setPassword makes the fake siad require the API password pw.
+func (s *fakeSiad) setPassword(pw string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.password = pw
+}
+
+// fakeClient returns a Sia API client talking to the server at url.
+func fakeClient(url string) *siadClient {
+	c, err := newSiadClient(url, siadOptions{}, "Sia-Agent")
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// scenarioDir returns the fixture directory of a scenario.
+func scenarioDir(scenario string) string {
+	return filepath.Join("testdata", "scenarios", scenario)
+}
+
+// resetAllModuleMetrics makes all module groups forget about earlier
+// collections and zeroes their metrics, and forgets siad's loaded modules.
+func resetAllModuleMetrics() {
+	loadedMu.Lock()
+	loadedModules = nil
+	loadedMu.Unlock()
+	moduleLoaded.Reset()
+	for _, g := range moduleGroups {
+		resetModuleMetrics(g)
+		for _, c := range g.collectors {
+			switch m := c.(type) {
+			case prometheus.Gauge:
+				m.Set(0)
+			case *prometheus.GaugeVec:
+				m.Reset()
+			}
+		}
+	}
+}
+
+// moduleRegistry returns a registry holding only the metrics of the modules
+// and whether siad loaded them.
+func moduleRegistry() *prometheus.Registry {
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(moduleLoaded)
+	for _, g := range moduleGroups {
+		reg.MustRegister(g)
+	}
+	return reg
+}
+
+// writeBigHostdb writes a hostdb_all.json fixture with n hosts to dir. Every
+// second host is active, every fourth inactive and the rest offline.
+func writeBigHostdb(t *testing.T, dir string, n int) {
+	type scan struct {
+		Success bool `json:"success"`
+	}
+	type host struct {
+		AcceptingContracts bool   `json:"acceptingcontracts"`
+		ScanHistory        []scan `json:"scanhistory"`
+		PublicKeyString    string `json:"publickeystring"`
+	}
+	hosts := make([]host, n)
+	for i := range hosts {
+		hosts[i].PublicKeyString = fmt.Sprintf("ed25519:%064x", i)
+		switch i % 4 {
+		case 0, 2:
+			hosts[i].AcceptingContracts = true
+			hosts[i].ScanHistory = []scan{{false}, {true}}
+		case 1:
+			hosts[i].ScanHistory = []scan{{true}}
+		case 3:
+			hosts[i].AcceptingContracts = true
+			hosts[i].ScanHistory = []scan{{true}, {false}}
+		}
+	}
+	b, err := json.Marshal(map[string]interface{}{"hosts": hosts})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "hostdb_all.json"), b, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollectorScenarios(t *testing.T) {
+	log = logrus.New()
+	log.SetOutput(ioutil.Discard)
+
+	tests := []struct {
+		scenario string
+		// setup optionally generates fixtures into the scenario's directory
+		setup func(t *testing.T, dir string)
+		// failing lists the modules whose collection is expected to fail
+		failing []string
+	}{
+		{scenario: "default"},
+		{scenario: "module_not_loaded"},
+		{scenario: "partial_failure", failing: []string{"gateway", "renter"}},
+		{scenario: "locked_wallet"},
+		{scenario: "big_hostdb", setup: func(t *testing.T, dir string) { writeBigHostdb(t, dir, 20000) }},
+	}
+	for _, test := range tests {
+		t.Run(test.scenario, func(t *testing.T) {
+			dirs := []string{scenarioDir("default")}
+			if test.scenario != "default" {
+				dirs = append(dirs, scenarioDir(test.scenario))
+			}
+			if test.setup != nil {
+				dir, err := ioutil.TempDir("", "sia_exporter")
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer os.RemoveAll(dir)
+				test.setup(t, dir)
+				dirs = append(dirs, dir)
+			}
+			siad := newFakeSiad(dirs...)
+			defer siad.Close()
+
+			resetAllModuleMetrics()
+			discoverModules(context.Background(), fakeClient(siad.URL))
+			collect(context.Background(), fakeClient(siad.URL), moduleCollectors)
+
+			for _, c := range loadedCollectors(moduleCollectors) {
+				expected := 1.0
+				for _, name := range test.failing {
+					if c.name == name {
+						expected = 0
+					}
+				}
+				if v := testutil.ToFloat64(scrapeSuccess.WithLabelValues(c.name)); v != expected {
+					t.Errorf("scrape success of %v was incorrect. expected %v got %v", c.name, expected, v)
+				}
+			}
+
+			golden := filepath.Join(scenarioDir(test.scenario), "expected.prom")
+			if *update {
+				writeGolden(t, golden)
+			}
+			f, err := os.Open(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			if err := testutil.GatherAndCompare(moduleRegistry(), f); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// writeGolden writes the current metrics of the modules to filename.
+func writeGolden(t *testing.T, filename string) {
+	mfs, err := moduleRegistry().Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	for _, mf := range mfs {
+		if _, err := expfmt.MetricFamilyToText(&buf, mf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filename, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
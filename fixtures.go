@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// fixtureName returns the name of the fixture file of an API path, without
+// extension. It is the path with slashes replaced by underscores, e.g.
+// renter_dir for /renter/dir/.
+func fixtureName(path string) string {
+	return strings.Replace(strings.Trim(path, "/"), "/", "_", -1)
+}
+
+// fixtureServer is a stand-in for siad serving recorded API responses from
+// fixture directories. The response of an endpoint is read from
+// <fixtureName>.json, or from <fixtureName>.<status>.json which is served
+// with that HTTP status instead of 200. Endpoints without a fixture are
+// answered with 404, which is how siad answers calls to modules that are not
+// loaded.
+//
+// Later directories take precedence over earlier ones, so a directory only
+// needs to contain the responses that differ from the ones before it.
+type fixtureServer struct {
+	dirs []string
+}
+
+func (s fixtureServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := fixtureName(r.URL.Path)
+	for i := len(s.dirs) - 1; i >= 0; i-- {
+		file, status := fixtureFile(s.dirs[i], name)
+		b, err := ioutil.ReadFile(file)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write(b)
+		return
+	}
+	w.WriteHeader(http.StatusNotFound)
+	fmt.Fprint(w, `{"message": "404 - Refer to API.md"}`)
+}
+
+// fixtureFile returns the fixture file of name in dir and the HTTP status it
+// is served with.
+func fixtureFile(dir, name string) (string, int) {
+	matches, _ := filepath.Glob(filepath.Join(dir, name+".*.json"))
+	for _, m := range matches {
+		status, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(filepath.Base(m), name+"."), ".json"))
+		if err == nil {
+			return m, status
+		}
+	}
+	return filepath.Join(dir, name+".json"), http.StatusOK
+}
+
+// serveFixtures starts a fixtureServer for dirs on a local port and returns
+// its address.
+func serveFixtures(dirs ...string) (string, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	go http.Serve(l, fixtureServer{dirs: dirs})
+	return l.Addr().String(), nil
+}
+
+// recorder records the responses of siad into a fixture directory that can be
+// served by a fixtureServer.
+type recorder struct {
+	dir string
+
+	mu       sync.Mutex
+	recorded int
+}
+
+// newRecorder creates a recorder recording into dir.
+func newRecorder(dir string) (*recorder, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &recorder{dir: dir}, nil
+}
+
+// transport returns a RoundTripper recording every response of next.
+func (rec *recorder) transport(next http.RoundTripper) http.RoundTripper {
+	return recordingTransport{rec: rec, next: next}
+}
+
+// recordingTransport is a RoundTripper recording the responses of another
+// RoundTripper with a recorder.
+type recordingTransport struct {
+	rec  *recorder
+	next http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t recordingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.rec.record(resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// record writes resp into the fixture file of its path, replacing earlier
+// recordings of the path.
+func (rec *recorder) record(resp *http.Response) error {
+	b, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(b))
+
+	name := fixtureName(resp.Request.URL.Path)
+	file := filepath.Join(rec.dir, name+".json")
+	if resp.StatusCode != http.StatusOK {
+		file = filepath.Join(rec.dir, fmt.Sprintf("%v.%d.json", name, resp.StatusCode))
+	}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	old, _ := filepath.Glob(filepath.Join(rec.dir, name+".*json"))
+	for _, f := range old {
+		os.Remove(f)
+	}
+	if err := ioutil.WriteFile(file, b, 0600); err != nil {
+		log.Warn("Error recording ", resp.Request.URL.Path, ": ", err)
+		return nil
+	}
+	rec.recorded++
+	return nil
+}
+
+// count returns the number of responses recorded.
+func (rec *recorder) count() int {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return rec.recorded
+}
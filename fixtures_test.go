@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+)
+
+func TestFixtureName(t *testing.T) {
+	tests := map[string]string{
+		"/consensus":   "consensus",
+		"/renter/dir/": "renter_dir",
+		"/hostdb/all":  "hostdb_all",
+		"/":            "",
+	}
+	for path, name := range tests {
+		if n := fixtureName(path); n != name {
+			t.Errorf("fixtureName(%q) was incorrect. expected %q got %q", path, name, n)
+		}
+	}
+}
+
+func TestRecordReplay(t *testing.T) {
+	log = logrus.New()
+	log.SetOutput(ioutil.Discard)
+
+	dir, err := ioutil.TempDir("", "sia_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Record the partial failure scenario
+	scenario := []string{scenarioDir("default"), scenarioDir("partial_failure")}
+	siad := newFakeSiad(scenario...)
+	defer siad.Close()
+	rec, err := newRecorder(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := fakeClient(siad.URL)
+	c.client.Transport = rec.transport(c.client.Transport)
+	resetAllModuleMetrics()
+	collect(context.Background(), c, moduleCollectors)
+	// Every endpoint but /renter, which is not called after
+	// /renter/contracts failed
+	if n := rec.count(); n != 10 {
+		t.Errorf("number of recorded responses was incorrect. expected %v got %v", 10, n)
+	}
+
+	// The recordings are the responses of the scenario
+	for _, name := range []string{"consensus", "host_storage", "gateway", "renter_contracts"} {
+		expected, _ := fixtureFile(scenario[0], name)
+		if f, _ := fixtureFile(scenario[1], name); fileExists(f) {
+			expected = f
+		}
+		recorded, _ := fixtureFile(dir, name)
+		if filepath.Base(recorded) != filepath.Base(expected) {
+			t.Errorf("recording of %v was incorrect. expected %v got %v", name, filepath.Base(expected), filepath.Base(recorded))
+			continue
+		}
+		eb, _ := ioutil.ReadFile(expected)
+		rb, err := ioutil.ReadFile(recorded)
+		if err != nil || !bytes.Equal(eb, rb) {
+			t.Errorf("recording of %v was incorrect. expected %s got %s (%v)", name, eb, rb, err)
+		}
+	}
+
+	// Replaying the recordings gives the metrics of the scenario
+	addr, err := serveFixtures(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resetAllModuleMetrics()
+	discoverModules(context.Background(), fakeClient(addr))
+	collect(context.Background(), fakeClient(addr), moduleCollectors)
+	f, err := os.Open(filepath.Join(scenarioDir("partial_failure"), "expected.prom"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := testutil.GatherAndCompare(moduleRegistry(), f); err != nil {
+		t.Error(err)
+	}
+}
+
+// fileExists returns whether filename exists.
+func fileExists(filename string) bool {
+	_, err := os.Stat(filename)
+	return err == nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// graphiteSink pushes the metrics to the plaintext endpoint of Graphite's
+// carbon.
+type graphiteSink struct {
+	addr   string
+	prefix string
+}
+
+// newGraphiteSink creates a graphiteSink pushing to carbon at addr, with
+// prefix prepended to every path.
+func newGraphiteSink(addr, prefix string) *graphiteSink {
+	return &graphiteSink{addr: addr, prefix: strings.Trim(prefix, ".")}
+}
+
+// Name implements sink.
+func (s *graphiteSink) Name() string {
+	return "graphite"
+}
+
+// Send implements sink. Points resent by a retry overwrite the ones already
+// received, as they have the same timestamp.
+func (s *graphiteSink) Send(ctx context.Context, mfs []*dto.MetricFamily) error {
+	lines := graphiteLines(mfs, s.prefix, time.Now())
+	return retry(ctx, func() error {
+		var d net.Dialer
+		dialCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+		conn, err := d.DialContext(dialCtx, "tcp", s.addr)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		conn.SetWriteDeadline(time.Now().Add(30 * time.Second))
+		_, err = conn.Write(lines)
+		return err
+	})
+}
+
+// graphiteLines renders the metric families as carbon plaintext lines at ts.
+// The path of a sample is its name followed by the names and values of its
+// labels, sorted by name, e.g.
+// sia_exporter_api_errors_total.endpoint._renter_dir.kind.auth.module.renter.
+func graphiteLines(mfs []*dto.MetricFamily, prefix string, ts time.Time) []byte {
+	var buf bytes.Buffer
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			for _, s := range flattenMetric(mf, m) {
+				if !finite(s.value) {
+					continue
+				}
+				fmt.Fprintf(&buf, "%v %v %d\n", graphitePath(prefix, s.name, m.GetLabel(), s.labels), formatFloat(s.value), ts.Unix())
+			}
+		}
+	}
+	return buf.Bytes()
+}
+
+// graphitePath returns the dotted path of a sample.
+func graphitePath(prefix, name string, labels []*dto.LabelPair, extra map[string]string) string {
+	pairs := make(map[string]string)
+	for _, lp := range labels {
+		pairs[lp.GetName()] = lp.GetValue()
+	}
+	for n, v := range extra {
+		pairs[n] = v
+	}
+	names := make([]string, 0, len(pairs))
+	for n := range pairs {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	var path []string
+	if prefix != "" {
+		path = append(path, prefix)
+	}
+	path = append(path, name)
+	for _, n := range names {
+		path = append(path, n, graphiteEscape(pairs[n]))
+	}
+	return strings.Join(path, ".")
+}
+
+// graphiteEscape replaces the characters of a label value that would break
+// up its path component or the line.
+func graphiteEscape(s string) string {
+	if s == "" {
+		return "_"
+	}
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '.', ' ', '\t', '\n', '/':
+			return '_'
+		}
+		return r
+	}, s)
+}
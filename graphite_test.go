@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+func TestGraphiteLines(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	height := prometheus.NewGauge(prometheus.GaugeOpts{Name: "sia_consensus_height", Help: "test"})
+	height.Set(250000)
+	errs := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "sia_exporter_api_errors_total", Help: "test"}, []string{"module", "endpoint"})
+	errs.WithLabelValues("renter", "/renter/dir").Add(2)
+	errs.WithLabelValues("host", "").Inc()
+	reg.MustRegister(height, errs)
+	mfs, _ := reg.Gather()
+
+	lines := string(graphiteLines(mfs, "sia.node1", time.Unix(1600000000, 0)))
+	expected := `sia.node1.sia_consensus_height 250000 1600000000
+sia.node1.sia_exporter_api_errors_total.endpoint._.module.host 1 1600000000
+sia.node1.sia_exporter_api_errors_total.endpoint._renter_dir.module.renter 2 1600000000
+`
+	if lines != expected {
+		t.Errorf("graphiteLines was incorrect. expected\n%v\ngot\n%v", expected, lines)
+	}
+}
+
+func TestGraphiteSink(t *testing.T) {
+	log = logrus.New()
+	log.SetOutput(ioutil.Discard)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	received := make(chan string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		received <- line
+	}()
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(prometheus.NewGauge(prometheus.GaugeOpts{Name: "sia_consensus_height", Help: "test"}))
+	mfs, _ := reg.Gather()
+	if err := newGraphiteSink(l.Addr().String(), "sia.").Send(context.Background(), mfs); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case line := <-received:
+		if !strings.HasPrefix(line, "sia.sia_consensus_height 0 ") {
+			t.Errorf("line was incorrect. expected sia.sia_consensus_height got %q", line)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no line received")
+	}
+}
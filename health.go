@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"gitlab.com/NebulousLabs/errors"
+)
+
+// Readiness checks.
+const (
+	// readyCheckSiad requires siad to answer API calls.
+	readyCheckSiad = "siad"
+	// readyCheckAuth requires siad to accept the API password, i.e. no module
+	// to have last failed with an authentication error.
+	readyCheckAuth = "auth"
+	// readyCheckCollected requires at least one module to have been collected
+	// successfully.
+	readyCheckCollected = "collected"
+	// readyCheckSynced requires the consensus to be synced.
+	readyCheckSynced = "synced"
+)
+
+// defaultReadyChecks are the readiness checks run by default.
+const defaultReadyChecks = readyCheckSiad + "," + readyCheckAuth + "," + readyCheckCollected
+
+// readyTimeout is how long the readiness checks wait for siad.
+var readyTimeout = 5 * time.Second
+
+// healthzHandler answers as long as the exporter is running.
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintln(w, "ok")
+}
+
+// readyHandler serves /readyz, which is ready when all of its checks pass.
+type readyHandler struct {
+	sc     apiClient
+	checks []string
+}
+
+// newReadyHandler creates a readyHandler running the comma separated checks
+// against sc.
+func newReadyHandler(sc apiClient, checks string) (*readyHandler, error) {
+	h := &readyHandler{sc: sc}
+	for _, check := range strings.Split(checks, ",") {
+		check = strings.TrimSpace(check)
+		switch check {
+		case "":
+			continue
+		case readyCheckSiad, readyCheckAuth, readyCheckCollected, readyCheckSynced:
+			h.checks = append(h.checks, check)
+		default:
+			return nil, fmt.Errorf("unknown readiness check %q, must be %v, %v, %v or %v", check, readyCheckSiad, readyCheckAuth, readyCheckCollected, readyCheckSynced)
+		}
+	}
+	return h, nil
+}
+
+// ServeHTTP implements http.Handler. It answers 200 if all checks pass and
+// 503 otherwise, listing the result of every check.
+func (h *readyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var synced bool
+	var consensusErr error
+	if h.needsConsensus() {
+		synced, consensusErr = h.consensusSynced(r.Context())
+	}
+
+	ready := true
+	var results []string
+	for _, check := range h.checks {
+		var err error
+		switch check {
+		case readyCheckSiad:
+			err = consensusErr
+		case readyCheckAuth:
+			err = authFailure()
+		case readyCheckCollected:
+			if !collectedOnce() {
+				err = errors.New("no module collected yet")
+			}
+		case readyCheckSynced:
+			err = consensusErr
+			if err == nil && !synced {
+				err = errors.New("consensus not synced")
+			}
+		}
+		if err != nil {
+			ready = false
+			results = append(results, check+": "+err.Error())
+			continue
+		}
+		results = append(results, check+": ok")
+	}
+	if !ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	fmt.Fprintln(w, strings.Join(results, "\n"))
+}
+
+// needsConsensus returns whether a check calls /consensus.
+func (h *readyHandler) needsConsensus() bool {
+	for _, check := range h.checks {
+		if check == readyCheckSiad || check == readyCheckSynced {
+			return true
+		}
+	}
+	return false
+}
+
+// consensusSynced calls /consensus, giving up after readyTimeout.
+func (h *readyHandler) consensusSynced(ctx context.Context) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, readyTimeout)
+	defer cancel()
+	cg, err := h.sc.ConsensusGet(ctx)
+	if ctx.Err() == context.DeadlineExceeded {
+		return false, fmt.Errorf("siad did not answer within %v", readyTimeout)
+	} else if err != nil {
+		return false, fmt.Errorf("siad not reachable: %v", err)
+	}
+	return cg.Synced, nil
+}
+
+// authFailure returns the error of a module whose last collection failed
+// because siad rejected the API password.
+func authFailure() error {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	for name, s := range collectionStatuses {
+		if s.err != nil && errorKind(s.err) == "auth" {
+			return fmt.Errorf("API password rejected collecting %v: %v", name, s.err)
+		}
+	}
+	return nil
+}
+
+// collectedOnce returns whether any module was collected successfully.
+func collectedOnce() bool {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	for _, s := range collectionStatuses {
+		if !s.lastSuccess.IsZero() {
+			return true
+		}
+	}
+	return false
+}
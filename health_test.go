@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"gitlab.com/NebulousLabs/errors"
+)
+
+// resetStatuses makes the status endpoints forget about earlier collections.
+func resetStatuses() {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	collectionStatuses = map[string]*collectionStatus{}
+}
+
+func TestReadyz(t *testing.T) {
+	log = logrus.New()
+	resetStatuses()
+	defer resetStatuses()
+	siad := newFakeSiad(scenarioDir("default"))
+	defer siad.Close()
+	sc := fakeClient(siad.URL)
+
+	h, err := newReadyHandler(sc, defaultReadyChecks+",synced")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// readyz returns the status code and body of /readyz
+	readyz := func() (int, string) {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+		return w.Code, w.Body.String()
+	}
+
+	// Not ready before the first collection
+	if code, body := readyz(); code != 503 || !strings.Contains(body, "collected: no module collected yet") {
+		t.Errorf("readyz was incorrect. expected 503 for no collection got %v\n%v", code, body)
+	}
+
+	recordStatus("consensus", 0, nil)
+	if code, body := readyz(); code != 200 || body != "siad: ok\nauth: ok\ncollected: ok\nsynced: ok\n" {
+		t.Errorf("readyz was incorrect. expected 200 got %v\n%v", code, body)
+	}
+
+	recordStatus("wallet", 0, errors.New("API authentication failed"))
+	if code, body := readyz(); code != 503 || !strings.Contains(body, "auth: API password rejected collecting wallet") {
+		t.Errorf("readyz was incorrect. expected 503 for the rejected password got %v\n%v", code, body)
+	}
+	recordStatus("wallet", 0, nil)
+
+	siad.setFailing("/consensus", true)
+	if code, body := readyz(); code != 503 || !strings.Contains(body, "siad: siad not reachable") {
+		t.Errorf("readyz was incorrect. expected 503 for an unreachable siad got %v\n%v", code, body)
+	}
+
+	if _, err := newReadyHandler(sc, "siad,wallet"); err == nil {
+		t.Errorf("newReadyHandler was incorrect. expected an error for check wallet")
+	}
+}
+
+func TestHealthz(t *testing.T) {
+	w := httptest.NewRecorder()
+	healthzHandler(w, httptest.NewRequest("GET", "/healthz", nil))
+	if w.Code != 200 || w.Body.String() != "ok\n" {
+		t.Errorf("healthz was incorrect. expected 200 ok got %v %q", w.Code, w.Body.String())
+	}
+}
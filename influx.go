@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// influxPoint is a line of the InfluxDB line protocol.
+type influxPoint struct {
+	measurement string
+	tags        map[string]string
+	fields      map[string]float64
+}
+
+// influxMeasurement returns the measurement of a metric, which is the module
+// for metrics of the Sia modules, e.g. sia_renter for
+// sia_renter_allowance_amount_siacoins, and the namespace for other metrics.
+func influxMeasurement(name string) string {
+	parts := strings.SplitN(name, "_", 3)
+	if parts[0] == "sia" && len(parts) == 3 {
+		return parts[0] + "_" + parts[1]
+	}
+	return parts[0]
+}
+
+// influxLines renders the metric families as InfluxDB line protocol at ts.
+// Samples of a measurement with the same labels become the fields of a single
+// line, with the labels as tags. Samples that InfluxDB cannot store, i.e. NaN
+// and infinite values, are left out.
+func influxLines(mfs []*dto.MetricFamily, ts time.Time) []byte {
+	points := make(map[string]*influxPoint)
+	for _, mf := range mfs {
+		measurement := influxMeasurement(mf.GetName())
+		for _, m := range mf.GetMetric() {
+			for _, s := range flattenMetric(mf, m) {
+				if !finite(s.value) {
+					continue
+				}
+				tags := make(map[string]string)
+				for _, lp := range m.GetLabel() {
+					tags[lp.GetName()] = lp.GetValue()
+				}
+				for name, value := range s.labels {
+					tags[name] = value
+				}
+				field := strings.TrimPrefix(s.name, measurement+"_")
+				if field == s.name {
+					field = "value"
+				}
+
+				key := influxEscape(measurement, ", ") + influxTags(tags)
+				p, ok := points[key]
+				if !ok {
+					p = &influxPoint{measurement: measurement, tags: tags, fields: make(map[string]float64)}
+					points[key] = p
+				}
+				p.fields[field] = s.value
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(points))
+	for key := range points {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var buf bytes.Buffer
+	for _, key := range keys {
+		p := points[key]
+		fields := make([]string, 0, len(p.fields))
+		for name, value := range p.fields {
+			fields = append(fields, influxEscape(name, ",= ")+"="+strconv.FormatFloat(value, 'g', -1, 64))
+		}
+		sort.Strings(fields)
+		fmt.Fprintf(&buf, "%v %v %d\n", key, strings.Join(fields, ","), ts.UnixNano())
+	}
+	return buf.Bytes()
+}
+
+// influxTags renders tags as the tag set of a line, including the leading
+// comma.
+func influxTags(tags map[string]string) string {
+	names := make([]string, 0, len(tags))
+	for name := range tags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var sb strings.Builder
+	for _, name := range names {
+		if tags[name] == "" {
+			// Empty tag values are not allowed
+			continue
+		}
+		sb.WriteString("," + influxEscape(name, ",= ") + "=" + influxEscape(tags[name], ",= "))
+	}
+	return sb.String()
+}
+
+// influxEscape escapes the characters in special with a backslash.
+func influxEscape(s, special string) string {
+	if !strings.ContainsAny(s, special+`\`) {
+		return s
+	}
+	var sb strings.Builder
+	for _, r := range s {
+		if r == '\\' || strings.ContainsRune(special, r) {
+			sb.WriteByte('\\')
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// influxHandler serves the metrics of g as InfluxDB line protocol, e.g. for
+// Telegraf's http input.
+func influxHandler(g prometheus.Gatherer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mfs, err := g.Gather()
+		if err != nil {
+			log.Warn("Error gathering metrics: ", err)
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write(influxLines(mfs, time.Now()))
+	})
+}
+
+// influxSink writes the metrics to the write API of InfluxDB.
+type influxSink struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+// newInfluxSink creates an influxSink writing to url, which is the complete
+// URL of the write API including the database or bucket, e.g.
+// http://influxdb:8086/write?db=sia for InfluxDB 1.x or
+// http://influxdb:8086/api/v2/write?org=sia&bucket=sia for InfluxDB 2.x. If
+// token is set it is sent as API token.
+func newInfluxSink(url, token string) *influxSink {
+	return &influxSink{url: url, token: token, client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+// Name implements sink.
+func (s *influxSink) Name() string {
+	return "influxdb"
+}
+
+// Send implements sink.
+func (s *influxSink) Send(ctx context.Context, mfs []*dto.MetricFamily) error {
+	body := influxLines(mfs, time.Now())
+	return retry(ctx, func() error { return s.write(ctx, body) })
+}
+
+// write posts lines to the write API.
+func (s *influxSink) write(ctx context.Context, lines []byte) error {
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(lines))
+	if err != nil {
+		return permanentError{err}
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Token "+s.token)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return classifyHTTPStatus(resp)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+// influxTestRegistry returns a registry with metrics of several modules.
+func influxTestRegistry() *prometheus.Registry {
+	reg := prometheus.NewRegistry()
+	height := prometheus.NewGauge(prometheus.GaugeOpts{Name: "sia_consensus_height", Help: "test"})
+	height.Set(250000)
+	synced := prometheus.NewGauge(prometheus.GaugeOpts{Name: "sia_consensus_synced", Help: "test"})
+	synced.Set(1)
+	errs := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "sia_exporter_api_errors_total", Help: "test"}, []string{"module", "kind"})
+	errs.WithLabelValues("renter", "auth").Add(2)
+	errs.WithLabelValues("host,db", "a b").Inc()
+	nan := prometheus.NewGauge(prometheus.GaugeOpts{Name: "sia_host_nan", Help: "test"})
+	nan.Set(math.NaN())
+	up := prometheus.NewGauge(prometheus.GaugeOpts{Name: "up", Help: "test"})
+	up.Set(1)
+	reg.MustRegister(height, synced, errs, nan, up)
+	return reg
+}
+
+func TestInfluxLines(t *testing.T) {
+	mfs, err := influxTestRegistry().Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := string(influxLines(mfs, time.Unix(1600000000, 0)))
+	expected := `sia_consensus height=250000,synced=1 1600000000000000000
+sia_exporter,kind=a\ b,module=host\,db api_errors_total=1 1600000000000000000
+sia_exporter,kind=auth,module=renter api_errors_total=2 1600000000000000000
+up value=1 1600000000000000000
+`
+	if lines != expected {
+		t.Errorf("influxLines was incorrect. expected\n%v\ngot\n%v", expected, lines)
+	}
+}
+
+// fakeInflux is a stand-in for the InfluxDB write API.
+type fakeInflux struct {
+	mu     sync.Mutex
+	status int
+	writes []*http.Request
+	bodies []string
+}
+
+func (f *fakeInflux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	b, _ := ioutil.ReadAll(r.Body)
+	f.writes = append(f.writes, r)
+	f.bodies = append(f.bodies, string(b))
+	w.WriteHeader(f.status)
+}
+
+func TestInfluxSink(t *testing.T) {
+	log = logrus.New()
+	log.SetOutput(ioutil.Discard)
+	defer func(r int, b time.Duration) { sinkRetries, sinkBackoff = r, b }(sinkRetries, sinkBackoff)
+	sinkRetries, sinkBackoff = 2, time.Millisecond
+
+	influx := &fakeInflux{status: http.StatusNoContent}
+	server := httptest.NewServer(influx)
+	defer server.Close()
+	s := newInfluxSink(server.URL+"/api/v2/write?org=sia&bucket=sia", "secret")
+
+	mfs, _ := influxTestRegistry().Gather()
+	if err := s.Send(context.Background(), mfs); err != nil {
+		t.Fatal(err)
+	}
+	if len(influx.writes) != 1 {
+		t.Fatalf("number of writes was incorrect. expected %v got %v", 1, len(influx.writes))
+	}
+	r := influx.writes[0]
+	if r.URL.Query().Get("bucket") != "sia" || r.Header.Get("Authorization") != "Token secret" {
+		t.Errorf("write was incorrect. expected bucket sia and token secret got %v %v", r.URL, r.Header.Get("Authorization"))
+	}
+	if !strings.Contains(influx.bodies[0], "sia_consensus height=250000,synced=1 ") {
+		t.Errorf("written lines were incorrect. expected sia_consensus got\n%v", influx.bodies[0])
+	}
+
+	// Bad requests are not retried, unavailable servers are
+	influx.status = http.StatusBadRequest
+	if err := s.Send(context.Background(), mfs); err == nil || len(influx.writes) != 2 {
+		t.Errorf("number of writes was incorrect. expected %v got %v (%v)", 2, len(influx.writes), err)
+	}
+	influx.status = http.StatusServiceUnavailable
+	if err := s.Send(context.Background(), mfs); err == nil || len(influx.writes) != 5 {
+		t.Errorf("number of writes was incorrect. expected %v got %v (%v)", 5, len(influx.writes), err)
+	}
+}
+
+func TestInfluxHandler(t *testing.T) {
+	log = logrus.New()
+	w := httptest.NewRecorder()
+	influxHandler(influxTestRegistry()).ServeHTTP(w, httptest.NewRequest("GET", "/influx", nil))
+	if !strings.HasPrefix(w.Body.String(), "sia_consensus height=250000,synced=1 ") {
+		t.Errorf("served lines were incorrect. expected sia_consensus first got\n%v", w.Body.String())
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// run runs the monitor refreshing the metrics as scheduled by s and serves
+// the registered handlers on addresses until ctx is done or serving fails.
+// When ctx is done it shuts down within shutdownTimeout: in-flight scrapes
+// are drained, the monitor is stopped and the metrics are sent to the sinks a
+// last time.
+func run(ctx context.Context, sc apiClient, s *schedule, addresses []string, webConfig string, shutdownTimeout time.Duration) error {
+	server := &http.Server{}
+	served := make(chan error, 1)
+	go func() {
+		served <- serveWeb(server, addresses, webConfig)
+	}()
+
+	monitored := make(chan struct{})
+	go func() {
+		startMonitor(ctx, sc, s)
+		close(monitored)
+	}()
+
+	select {
+	case err := <-served:
+		// Serving failed, e.g. because the address is in use
+		return err
+	case <-ctx.Done():
+	}
+	log.Info("Shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Warn("Scrapes still in flight at shutdown: ", err)
+	}
+	select {
+	case <-monitored:
+	case <-shutdownCtx.Done():
+		log.Warn("Monitor still refreshing at shutdown")
+	}
+	sendToSinks(shutdownCtx)
+	closeSinks()
+	if err := <-served; err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
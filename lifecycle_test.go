@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/sirupsen/logrus"
+)
+
+// testSink is a sink counting sends and closes.
+type testSink struct {
+	mu     sync.Mutex
+	sent   int
+	closed bool
+}
+
+func (s *testSink) Name() string {
+	return "test"
+}
+
+func (s *testSink) Send(ctx context.Context, mfs []*dto.MetricFamily) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent++
+	return nil
+}
+
+func (s *testSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+// freeAddress returns a loopback address with a free port.
+func freeAddress(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+// testSchedule returns a schedule without collectors.
+func testSchedule() *schedule {
+	return newSchedule(nil, time.Minute, nil, time.Minute, time.Now())
+}
+
+func TestRunShutdown(t *testing.T) {
+	log = logrus.New()
+	log.SetOutput(ioutil.Discard)
+	ts := &testSink{}
+	defer func(s []sink) { sinks = s }(sinks)
+	sinks = []sink{ts}
+
+	// A scrape that is in flight when the shutdown starts
+	started, release := make(chan struct{}), make(chan struct{})
+	http.HandleFunc("/lifecycle-test", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		fmt.Fprint(w, "ok")
+	})
+
+	address := freeAddress(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- run(ctx, nil, testSchedule(), []string{address}, "", 5*time.Second)
+	}()
+
+	scraped := make(chan error, 1)
+	go func() {
+		var resp *http.Response
+		var err error
+		for i := 0; i < 50; i++ {
+			if resp, err = http.Get("http://" + address + "/lifecycle-test"); err == nil {
+				resp.Body.Close()
+				break
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		scraped <- err
+	}()
+	<-started
+	cancel()
+
+	// The shutdown waits for the scrape
+	select {
+	case err := <-done:
+		t.Fatalf("run returned before the scrape finished: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(release)
+	if err := <-scraped; err != nil {
+		t.Errorf("scrape was incorrect. expected no error got %v", err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("run was incorrect. expected no error got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("run did not return after the shutdown")
+	}
+
+	// and flushes the sinks
+	if ts.sent != 1 || !ts.closed {
+		t.Errorf("sink was incorrect. expected 1 send and closed got %v sends and closed %v", ts.sent, ts.closed)
+	}
+}
+
+func TestRunServeError(t *testing.T) {
+	log = logrus.New()
+	log.SetOutput(ioutil.Discard)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := run(ctx, nil, testSchedule(), []string{l.Addr().String()}, "", time.Second); err == nil {
+		t.Errorf("run was incorrect. expected an error for an address in use")
+	}
+}
+
+func TestStartMonitorStops(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		startMonitor(ctx, nil, testSchedule())
+		close(done)
+	}()
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("startMonitor did not stop")
+	}
+}
+
+func TestSleepJitterStops(t *testing.T) {
+	log = logrus.New()
+	log.SetOutput(ioutil.Discard)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		sleepJitter(ctx, time.Hour)
+		close(done)
+	}()
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("sleepJitter did not stop")
+	}
+}
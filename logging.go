@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// logFormatText is logrus' default format, colored on terminals.
+	logFormatText = "text"
+	// logFormatLogfmt is key=value pairs, one entry per line.
+	logFormatLogfmt = "logfmt"
+	// logFormatJSON is a JSON object per line.
+	logFormatJSON = "json"
+)
+
+// repeats deduplicates repeated identical log entries.
+var repeats = newLogDedup(5 * time.Minute)
+
+// initLogger initializes the logger with a level and format. debug enables
+// the debug level regardless of level.
+func initLogger(debug bool, level, format string) error {
+	log = logrus.New()
+
+	// Define logger level
+	lvl, err := logrus.ParseLevel(level)
+	if err != nil {
+		return fmt.Errorf("unknown log level %q, must be debug, info, warn or error", level)
+	}
+	if debug {
+		lvl = logrus.DebugLevel
+		// Print out file names and line numbers
+		log.SetReportCaller(true)
+	}
+	log.SetLevel(lvl)
+
+	switch format {
+	case logFormatText:
+	case logFormatLogfmt:
+		log.SetFormatter(&logrus.TextFormatter{DisableColors: true, FullTimestamp: true})
+	case logFormatJSON:
+		log.SetFormatter(&logrus.JSONFormatter{})
+	default:
+		return fmt.Errorf("unknown log format %q, must be %v, %v or %v", format, logFormatText, logFormatLogfmt, logFormatJSON)
+	}
+	return nil
+}
+
+// logDedup logs repeated identical entries only once per interval, so that a
+// module that is down does not flood the logs every refresh. The repeats in
+// between are counted and reported along with the next entry logged, and when
+// the failure is resolved.
+type logDedup struct {
+	interval time.Duration
+
+	mu sync.Mutex
+	// entries holds the repeated entries by key and message.
+	entries map[string]map[string]*dedupEntry
+}
+
+// dedupEntry is an entry that was logged and is being repeated.
+type dedupEntry struct {
+	logged     time.Time
+	suppressed int
+}
+
+// newLogDedup creates a logDedup logging repeated entries once per interval.
+// An interval of 0 logs every entry.
+func newLogDedup(interval time.Duration) *logDedup {
+	return &logDedup{interval: interval, entries: make(map[string]map[string]*dedupEntry)}
+}
+
+// log logs msg with the fields of entry at level, unless the same message
+// and fields were logged under key within the interval. key groups the
+// entries resolve clears, e.g. all failures of an API endpoint.
+func (d *logDedup) log(key string, entry *logrus.Entry, level logrus.Level, msg string) {
+	id := msg + " " + dedupFields(entry.Data)
+	now := time.Now()
+	d.mu.Lock()
+	if d.entries[key] == nil {
+		d.entries[key] = make(map[string]*dedupEntry)
+	}
+	e, ok := d.entries[key][id]
+	if ok && d.interval > 0 && now.Sub(e.logged) < d.interval {
+		e.suppressed++
+		d.mu.Unlock()
+		return
+	}
+	suppressed := 0
+	if ok {
+		suppressed = e.suppressed
+	}
+	d.entries[key][id] = &dedupEntry{logged: now}
+	d.mu.Unlock()
+
+	if suppressed > 0 {
+		entry = entry.WithField("repeated", suppressed)
+		msg = fmt.Sprintf("%v (repeated %v times in the last %v)", msg, suppressed, d.interval)
+	}
+	entry.Log(level, msg)
+}
+
+// resolve forgets the entries logged under key. If any were logged, msg is
+// logged at info level with the fields of entry and the number of repeats
+// since.
+func (d *logDedup) resolve(key string, entry *logrus.Entry, msg string) {
+	d.mu.Lock()
+	entries, ok := d.entries[key]
+	delete(d.entries, key)
+	d.mu.Unlock()
+	if !ok {
+		return
+	}
+	suppressed := 0
+	for _, e := range entries {
+		suppressed += e.suppressed
+	}
+	if suppressed > 0 {
+		entry = entry.WithField("repeated", suppressed)
+	}
+	entry.Info(msg)
+}
+
+// dedupFields returns the fields identifying a log entry, leaving out the
+// IDs of Sia API calls, which differ on every call.
+func dedupFields(fields logrus.Fields) string {
+	var pairs []string
+	for k, v := range fields {
+		if k != "call_id" {
+			pairs = append(pairs, fmt.Sprintf("%v=%v", k, v))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, " ")
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"gitlab.com/NebulousLabs/errors"
+)
+
+func TestInitLogger(t *testing.T) {
+	defer func(l *logrus.Logger) { log = l }(log)
+	if err := initLogger(false, "warn", logFormatJSON); err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	log.SetOutput(&b)
+	log.Info("hidden")
+	log.WithField("module", "wallet").Warn("shown")
+	var entry map[string]interface{}
+	if err := json.Unmarshal(b.Bytes(), &entry); err != nil {
+		t.Fatalf("log was incorrect. expected a JSON entry got %q: %v", b.String(), err)
+	}
+	if entry["msg"] != "shown" || entry["module"] != "wallet" || entry["level"] != "warning" {
+		t.Errorf("log entry was incorrect. expected the warning with its module got %v", entry)
+	}
+
+	if err := initLogger(true, "error", logFormatLogfmt); err != nil || log.GetLevel() != logrus.DebugLevel {
+		t.Errorf("level was incorrect. expected %v with -debug got %v (%v)", logrus.DebugLevel, log.GetLevel(), err)
+	}
+	if err := initLogger(false, "loud", logFormatText); err == nil {
+		t.Errorf("initLogger was incorrect. expected an error for an unknown level")
+	}
+	if err := initLogger(false, "info", "xml"); err == nil {
+		t.Errorf("initLogger was incorrect. expected an error for an unknown format")
+	}
+}
+
+func TestLogDedup(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	d := newLogDedup(time.Hour)
+	entry := logger.WithField("module", "wallet")
+	for i := 0; i < 3; i++ {
+		d.log("wallet", entry.WithField("call_id", i), logrus.WarnLevel, "Sia API call failed")
+	}
+	d.log("wallet", logger.WithField("module", "wallet"), logrus.WarnLevel, "another error")
+	if len(hook.Entries) != 2 {
+		t.Fatalf("number of entries was incorrect. expected %v got %v", 2, len(hook.Entries))
+	}
+
+	// The repeats are reported once the interval passed
+	d.entries["wallet"]["Sia API call failed module=wallet"].logged = time.Now().Add(-2 * time.Hour)
+	d.log("wallet", entry, logrus.WarnLevel, "Sia API call failed")
+	last := hook.LastEntry()
+	if len(hook.Entries) != 3 || last.Data["repeated"] != 2 || !strings.Contains(last.Message, "repeated 2 times") {
+		t.Errorf("summary was incorrect. expected 2 repeats got %v entries, last %q %v", len(hook.Entries), last.Message, last.Data)
+	}
+
+	// and when the failure is resolved
+	d.log("wallet", entry, logrus.WarnLevel, "Sia API call failed")
+	d.resolve("wallet", entry, "Sia API call succeeded again")
+	last = hook.LastEntry()
+	if len(hook.Entries) != 4 || last.Level != logrus.InfoLevel || last.Data["repeated"] != 1 {
+		t.Errorf("resolution was incorrect. expected an info entry with 1 repeat got %v entries, last %q %v", len(hook.Entries), last.Message, last.Data)
+	}
+	d.resolve("wallet", entry, "Sia API call succeeded again")
+	if len(hook.Entries) != 4 {
+		t.Errorf("number of entries was incorrect. expected no entry for a key that did not fail got %v", len(hook.Entries))
+	}
+}
+
+func TestRecordAPICallLogs(t *testing.T) {
+	defer func(l *logrus.Logger, d *logDedup) { log, repeats = l, d }(log, repeats)
+	var hook *test.Hook
+	log, hook = test.NewNullLogger()
+	repeats = newLogDedup(time.Hour)
+
+	for i := 0; i < 5; i++ {
+		recordAPICall("gateway", "/gateway", "127.0.0.1:9980", errors.New("connection refused"))
+	}
+	if len(hook.Entries) != 1 {
+		t.Fatalf("number of entries was incorrect. expected %v got %v", 1, len(hook.Entries))
+	}
+	e := hook.LastEntry()
+	if e.Level != logrus.WarnLevel || e.Data["module"] != "gateway" || e.Data["endpoint"] != "/gateway" || e.Data["target"] != "127.0.0.1:9980" || e.Data["kind"] != "connection" {
+		t.Errorf("log entry was incorrect. expected a warning with module, endpoint, target and kind got %v %v", e.Level, e.Data)
+	}
+
+	recordAPICall("gateway", "/gateway", "127.0.0.1:9980", nil)
+	if e := hook.LastEntry(); len(hook.Entries) != 2 || e.Data["repeated"] != 4 {
+		t.Errorf("log entry was incorrect. expected the recovery after 4 repeats got %v", e.Data)
+	}
+}
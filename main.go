@@ -1,17 +1,19 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
+	"math/rand"
 	"net/http"
 	"os"
-	"strconv"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
-	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
-	"gitlab.com/NebulousLabs/Sia/build"
-	sia "gitlab.com/NebulousLabs/Sia/node/api/client"
 )
 
 var (
@@ -21,39 +23,6 @@ var (
 	log *logrus.Logger
 )
 
-//initSiaClient sets the values of the client so we can communicate with the
-//Sia Daemon.
-func findPassword() (string, error) {
-	// Check environment variables
-	apiPassword := os.Getenv("SIA_API_PASSWORD")
-	if apiPassword != "" {
-		log.Info("Using SIA_API_PASSWORD environment variable")
-		return apiPassword, nil
-	}
-
-	// No password passed in, fetch the API Password
-	pw, err := build.APIPassword()
-	if err != nil {
-		log.Fatal("Exiting: Error getting API Password:", err)
-	}
-	return pw, err
-}
-
-// initLogger initializes the logger
-func initLogger(debug bool) {
-	log = logrus.New()
-
-	// Define logger level
-	if debug {
-		log.SetLevel(logrus.DebugLevel)
-		// Print out file names and line numbers
-		log.SetReportCaller(true)
-	} else {
-		log.SetLevel(logrus.InfoLevel)
-	}
-
-}
-
 // boolToFloat64 converts a bool to a float64
 func boolToFloat64(b bool) float64 {
 	if b {
@@ -62,87 +31,385 @@ func boolToFloat64(b bool) float64 {
 	return float64(0)
 }
 
-// startMonitor refreshes the Sia metrics periodically as defined by refreshRate
-func startMonitor(refreshRate time.Duration, sc *sia.Client) {
-	for range time.Tick(time.Minute * refreshRate) {
-		updateMetrics(sc)
+// sleepJitter waits a random time of up to jitter, or until ctx is done, so
+// that exporters started at the same time do not hit their nodes in lockstep.
+func sleepJitter(ctx context.Context, jitter time.Duration) {
+	if jitter <= 0 {
+		return
+	}
+	d := time.Duration(rand.Int63n(int64(jitter)))
+	log.Info("Delaying the first refresh by ", d)
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
 	}
 }
 
-// updateMetrics calls the various metric collection functions
-func updateMetrics(sc *sia.Client) {
+// startMonitor refreshes the collectors as scheduled and sends the metrics to
+// the sinks after every refresh, until ctx is done.
+func startMonitor(ctx context.Context, sc apiClient, s *schedule) {
+	if s.next().IsZero() {
+		// Nothing to refresh
+		<-ctx.Done()
+		return
+	}
+	for {
+		timer := time.NewTimer(time.Until(s.next()))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
 
-	log.Debug("Updating metrics for modules:", module)
+		// Give up on modules that are still being collected when the next
+		// refresh is due
+		due, timeout := s.dueCollectors(time.Now())
+		if len(due) == 0 {
+			continue
+		}
+		refreshCtx, cancel := context.WithTimeout(ctx, timeout)
+		updateExchangeRate()
+		discoverModules(refreshCtx, sc)
+		errs := collect(refreshCtx, sc, due)
+		now := time.Now()
+		for _, c := range due {
+			s.done(c.name, errs[c.name], now)
+		}
+		sendToSinks(refreshCtx)
+		cancel()
+	}
+}
 
-	log.Debug("Updating Daemon Metrics")
-	daemonMetrics(sc)
+// usage prints the usage of sia_exporter and its commands.
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), `Usage: %v [record|replay|collectors] [flags]
 
-	if strings.Contains(module, "r") {
-		log.Debug("Updating Renter Metrics")
-		renterMetrics(sc)
-		log.Debug("Updating hostdb Metrics")
-		hostdbMetrics(sc)
-	}
+Without a command, sia_exporter serves the metrics of a live siad.
+  record    collect the enabled modules once and record the Sia API responses
+            into the -out directory
+  replay    serve metrics from the Sia API responses recorded in the -fixtures
+            directory instead of a live siad
+  collectors
+            list the collectors and whether the flags enable them
 
-	if strings.Contains(module, "c") {
-		log.Debug("Updating Consensus Metrics")
-		consensusMetrics(sc)
-	}
+Flags:
+`, os.Args[0])
+	flag.PrintDefaults()
+}
 
-	if strings.Contains(module, "w") {
-		log.Debug("Updating Wallet Metrics")
-		walletMetrics(sc)
-	}
+// updateMetrics calls the metric collection functions of collectors. The
+// exchange rate is left to the refreshes, so that collections on scrape do not
+// wait for it.
+func updateMetrics(ctx context.Context, sc apiClient, collectors []moduleCollector) {
 
-	if strings.Contains(module, "g") {
-		log.Debug("Updating Gateway Metrics")
-		gatewayMetrics(sc)
-	}
+	log.Debug("Updating metrics for modules:", module)
 
-	if strings.Contains(module, "h") {
-		log.Debug("Updating Host Metrics")
-		hostMetrics(sc)
-	}
+	discoverModules(ctx, sc)
+	collect(ctx, sc, collectors)
 
 	if strings.Contains(module, "m") {
-		log.Info("Miner metrics are not implemented yet")
+		repeats.log("miner", log.WithField("module", "miner"), logrus.InfoLevel, "Miner metrics are not implemented yet")
 	}
 
 	if strings.Contains(module, "t") {
-		log.Info("Transactionpool metrics are not implemented yet")
+		repeats.log("transactionpool", log.WithField("module", "transactionpool"), logrus.InfoLevel, "Transactionpool metrics are not implemented yet")
 	}
 
 }
 
 func main() {
 
+	// Subcommands
+	command := ""
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		command = os.Args[1]
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+	}
+	var out, fixtures *string
+	switch command {
+	case "":
+	case "record":
+		out = flag.String("out", "", "Directory to record the Sia API responses to")
+	case "replay":
+		fixtures = flag.String("fixtures", "", "Directory of recorded Sia API responses to serve metrics from")
+	case "collectors":
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q, must be record, replay or collectors\n", command)
+		os.Exit(2)
+	}
+	flag.Usage = usage
+
 	// Flags
 	flag.BoolVar(&debug, "debug", false, "Enable debug mode. Warning: generates a lot of output.")
-	address := flag.String("address", "127.0.0.1:9980", "Sia's API address")
+	logLevel := flag.String("log.level", "info", "Only log messages with the given severity or above: debug, info, warn or error")
+	logFormat := flag.String("log.format", logFormatText, "Log format: text, logfmt or json")
+	flag.DurationVar(&repeats.interval, "log.dedup-interval", repeats.interval, "Log repeated identical errors only once per interval along with the number of repeats, 0 logs every error")
+	address := flag.String("address", "127.0.0.1:9980", "Sia's API address: host:port, an https:// URL of siad behind a TLS reverse proxy or a unix:// URL of its socket")
+	var siadOpts siadOptions
+	flag.StringVar(&siadOpts.caFile, "siad.ca-file", "", "PEM file of the CAs to verify the certificate of an https:// siad address with (default is the system CAs)")
+	flag.BoolVar(&siadOpts.insecureSkipVerify, "siad.insecure-skip-verify", false, "Do not verify the certificate of an https:// siad address")
+	flag.StringVar(&siadOpts.proxy, "siad.proxy", "", "URL of an HTTP proxy to connect to siad through (default is the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables)")
+	siadModuleAddresses := flag.String("siad.module-addresses", "", "Comma separated module=address pairs of the modules served by a siad of their own, e.g. host=127.0.0.1:9990")
 	agent := flag.String("agent", "Sia-Agent", "Sia agent")
-	refresh := flag.Int("refresh", 5, "Frequency to get Metrics from Sia (minutes)")
-	port := flag.Int("port", 9983, "Port to serve Prometheus Metrics on")
-	flag.StringVar(&module, "modules", "cghmrtw", "Sia Modules to monitor")
+	passwordFile := flag.String("api-password-file", "", "File to read Sia's API password from (default is SIA_API_PASSWORD or the apipassword file in SIA_DATA_DIR or Sia's default data directory)")
+	refresh := refreshInterval(5 * time.Minute)
+	flag.Var(&refresh, "refresh", "Frequency to get Metrics from Sia: a duration such as 15s, or a number of minutes")
+	moduleRefresh := flag.String("refresh.modules", "", "Comma separated module=interval list of modules refreshed at a different frequency than -refresh, e.g. hostdb=1h,consensus=15s")
+	jitter := flag.Duration("refresh.jitter", 0, "Maximum random delay before the first refresh, spreading the load of many exporters on their nodes")
+	maxBackoff := flag.Duration("refresh.max-backoff", 10*time.Minute, "Maximum interval a module that keeps failing backs off to, doubling its interval after every failure")
+	port := flag.Int("port", 9983, "Port to serve Prometheus Metrics on, on all interfaces unless -web.listen-address is set")
+	listenAddress := flag.String("web.listen-address", "", "Comma separated addresses to serve the metrics on, e.g. 127.0.0.1:9983")
+	shutdownTimeout := flag.Duration("web.shutdown-timeout", 10*time.Second, "Maximum time to wait for in-flight scrapes and the final send to the sinks when shutting down")
+	webConfig := flag.String("web.config.file", "", "Path to a web configuration file in the exporter-toolkit format enabling TLS and authentication")
+	flag.StringVar(&module, "modules", moduleFlags, "Sia Modules to monitor: c (consensus), g (gateway), h (host), m (miner), r (renter and hostdb), t (transactionpool) and w (wallet)")
+	registerCollectorFlags(flag.CommandLine)
+	fiatSource := flag.String("fiat.source", "", "Exchange rate source for fiat valuation of siacoin metrics: static:<rate>, file:<path> or an http(s) URL")
+	flag.StringVar(&fiatCurrency, "fiat.currency", "usd", "Fiat currency siacoin metrics are valued in")
+	fiatPath := flag.String("fiat.json-path", "", "Dotted path of the exchange rate in JSON documents (default is the fiat currency)")
+	flag.StringVar(&stalePolicy, "stale.policy", stalePolicyKeep, "What to export for a module whose collection failed: keep (last good values) or omit")
+	onScrape := flag.Bool("collect.on-scrape", false, "Collect metrics on every scrape, within Prometheus' scrape timeout, in addition to every refresh")
+	flag.IntVar(&collectConcurrency, "collect.concurrency", collectConcurrency, "Maximum number of modules collected at once")
+	flag.DurationVar(&moduleTimeout, "collect.module-timeout", moduleTimeout, "Maximum time the collection of a single module may take")
+	flag.DurationVar(&scrapeTimeoutOffset, "collect.timeout-offset", scrapeTimeoutOffset, "Time subtracted from Prometheus' scrape timeout to leave for serving the metrics")
+	cacheTTLs := flag.String("cache.ttl", defaultCacheTTLs, "Comma separated endpoint=duration list of how long to cache Sia API responses")
+	readyChecks := flag.String("ready.checks", defaultReadyChecks, "Comma separated checks /readyz requires to pass: siad (reachable), auth (API password accepted), collected (a module was collected) and synced (consensus synced)")
+	legacy := flag.Bool("metrics.legacy-names", true, "Also export the metrics under their deprecated names without sia_ namespace and unit suffixes")
+	pushURL := flag.String("push.url", "", "URL of a Prometheus Pushgateway to push the metrics to after every refresh")
+	pushJob := flag.String("push.job", "sia_exporter", "Job name of the metrics pushed to the Pushgateway")
+	pushInstance := flag.String("push.instance", "", "Instance name of the metrics pushed to the Pushgateway (default is the hostname)")
+	pushUsername := flag.String("push.username", "", "Username for basic authentication with the Pushgateway")
+	pushPassword := flag.String("push.password", "", "Password for basic authentication with the Pushgateway")
+	flag.IntVar(&sinkRetries, "push.retries", sinkRetries, "How often a failed push is retried, with exponential backoff")
+	remoteWriteURL := flag.String("remote-write.url", "", "Prometheus remote_write URL to send the metrics to after every refresh")
+	remoteWriteDir := flag.String("remote-write.queue-dir", "remote_write_queue", "Directory of the on-disk queue of batches not yet sent to the remote_write URL")
+	remoteWriteMaxBytes := flag.Int64("remote-write.queue-max-bytes", 64<<20, "Maximum size of the remote_write queue, the oldest batches are dropped beyond it")
+	remoteWriteLabels := flag.String("remote-write.labels", "job=sia_exporter", "Comma separated name=value labels added to every series sent to the remote_write URL, instance defaults to the hostname")
+	remoteWriteUsername := flag.String("remote-write.username", "", "Username for basic authentication with the remote_write URL")
+	remoteWritePassword := flag.String("remote-write.password", "", "Password for basic authentication with the remote_write URL")
+	influxURL := flag.String("influx.url", "", "InfluxDB write API URL including the database or bucket to write the metrics to after every refresh")
+	influxToken := flag.String("influx.token", "", "InfluxDB API token")
+	graphiteAddr := flag.String("graphite.addr", "", "host:port of the carbon plaintext endpoint to push the metrics to after every refresh")
+	graphitePrefix := flag.String("graphite.prefix", "", "Prefix of the Graphite paths of the metrics, e.g. sia.node1")
+	otlpEndpoint := flag.String("otlp.endpoint", "", "OTLP endpoint to export the metrics to after every refresh: the metrics URL for http/protobuf, e.g. http://collector:4318/v1/metrics, host:port for grpc")
+	otlpProtocol := flag.String("otlp.protocol", otlpProtocolHTTP, "OTLP protocol: http/protobuf or grpc")
+	otlpInsecure := flag.Bool("otlp.insecure", false, "Disable TLS for OTLP over grpc")
+	otlpNetwork := flag.String("otlp.network", "mainnet", "Sia network reported as sia.network resource attribute")
+	otlpAttributes := flag.String("otlp.resource-attributes", "", "Comma separated name=value resource attributes added to or overriding the default ones")
+	statsdAddr := flag.String("statsd.addr", "", "host:port of a StatsD server to emit the metrics to over UDP after every refresh, with labels as DogStatsD tags")
 	flag.Parse()
 
 	// Initialize the logger
-	initLogger(debug)
+	if err := initLogger(debug, *logLevel, *logFormat); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	// Shut down cleanly on SIGINT and SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := validateModules(module); err != nil {
+		log.Fatal("Exiting: ", err)
+	}
+	if command == "collectors" {
+		listCollectors(os.Stdout)
+		return
+	}
+	if err := validateStalePolicy(stalePolicy); err != nil {
+		log.Fatal("Exiting: ", err)
+	}
+	if *webConfig != "" {
+		if err := validateWebConfig(*webConfig); err != nil {
+			log.Fatal("Exiting: ", err)
+		}
+	}
 
-	// Set the Sia Client connection information
-	sc := sia.New(sia.Options{Address: *address})
-	sc.UserAgent = *agent
-	sc.Password, _ = findPassword()
+	// Set up the exchange rate source for fiat valuation
+	if *fiatSource != "" {
+		if *fiatPath == "" {
+			*fiatPath = fiatCurrency
+		}
+		var err error
+		rateSource, err = newRateSource(*fiatSource, *fiatPath)
+		if err != nil {
+			log.Fatal("Exiting: ", err)
+		}
+	}
+
+	// Record the responses of a live siad, or replay recorded responses in
+	// place of one
+	siadAddress := *address
+	moduleAddresses, err := parseModuleAddresses(*siadModuleAddresses)
+	if err != nil {
+		log.Fatal("Exiting: ", err)
+	}
+	var rec *recorder
+	switch command {
+	case "record":
+		if *out == "" {
+			log.Fatal("Exiting: -out is required")
+		}
+		rec, err = newRecorder(*out)
+		if err != nil {
+			log.Fatal("Exiting: Error starting recorder: ", err)
+		}
+	case "replay":
+		if *fixtures == "" {
+			log.Fatal("Exiting: -fixtures is required")
+		}
+		*address, err = serveFixtures(*fixtures)
+		if err != nil {
+			log.Fatal("Exiting: Error serving fixtures: ", err)
+		}
+		siadOpts, moduleAddresses = siadOptions{}, nil
+		log.Info("Replaying Sia API responses from ", *fixtures)
+	}
+
+	// Set the Sia Client connection information. The password is read again
+	// whenever siad rejects it.
+	find := func() (string, error) { return findPassword(*passwordFile) }
+	if command == "replay" {
+		find = func() (string, error) { return "", nil }
+	}
+	newClient := func(address string) apiClient {
+		c, err := newSiadClient(address, siadOpts, *agent)
+		if err != nil {
+			log.Fatal("Exiting: Error connecting to siad: ", err)
+		}
+		if rec != nil {
+			c.client.Transport = rec.transport(c.client.Transport)
+		}
+		return recordingClient{client: newAuthClient(c, find), target: address}
+	}
+	if command != "replay" {
+		log.Info("Connecting to siad at ", siadAddress)
+	}
+	sc := moduleClient{client: newClient(*address), modules: make(map[string]apiClient)}
+	separateModules = make(map[string]bool)
+	for module, a := range moduleAddresses {
+		log.Info("Connecting to siad at ", a, " for the ", module, " module")
+		sc.modules[module] = newClient(a)
+		separateModules[module] = true
+	}
+
+	// Record a single collection of the enabled modules
+	if rec != nil {
+		collect(ctx, sc, enabledCollectors(module))
+		log.Info("Recorded ", rec.count(), " Sia API responses to ", *out)
+		return
+	}
+
+	// Cache the responses of expensive API calls
+	ttls, err := parseCacheTTLs(*cacheTTLs)
+	if err != nil {
+		log.Fatal("Exiting: ", err)
+	}
+	client := newCachedClient(sc, ttls)
+	ready, err := newReadyHandler(client, *readyChecks)
+	if err != nil {
+		log.Fatal("Exiting: ", err)
+	}
+
+	if *legacy {
+		log.Info("Also exporting metrics under their deprecated names, disable with -metrics.legacy-names=false")
+	}
+	newHandler := func(g prometheus.Gatherer) http.Handler {
+		if *legacy {
+			g = legacyGatherer{g}
+		}
+		return newMetricsHandler(g)
+	}
+
+	// Push the metrics for nodes that cannot be scraped
+	if *pushURL != "" {
+		if *pushInstance == "" {
+			*pushInstance, _ = os.Hostname()
+		}
+		log.Info("Pushing metrics to ", *pushURL, " as job ", *pushJob, ", instance ", *pushInstance)
+		sinks = append(sinks, newPushgatewaySink(*pushURL, *pushJob, *pushInstance, *pushUsername, *pushPassword))
+	}
+	if *remoteWriteURL != "" {
+		labels, err := parseLabels(*remoteWriteLabels)
+		if err != nil {
+			log.Fatal("Exiting: ", err)
+		}
+		if _, ok := labels["instance"]; !ok {
+			labels["instance"], _ = os.Hostname()
+		}
+		rw, err := newRemoteWriteSink(*remoteWriteURL, *remoteWriteDir, *remoteWriteMaxBytes, labels, *remoteWriteUsername, *remoteWritePassword)
+		if err != nil {
+			log.Fatal("Exiting: Error opening remote_write queue: ", err)
+		}
+		log.Info("Sending metrics to ", *remoteWriteURL)
+		sinks = append(sinks, rw)
+	}
+	if *influxURL != "" {
+		log.Info("Writing metrics to ", *influxURL)
+		sinks = append(sinks, newInfluxSink(*influxURL, *influxToken))
+	}
+	if *graphiteAddr != "" {
+		log.Info("Pushing metrics to Graphite at ", *graphiteAddr)
+		sinks = append(sinks, newGraphiteSink(*graphiteAddr, *graphitePrefix))
+	}
+	if *otlpEndpoint != "" {
+		attributes, err := parseLabels(*otlpAttributes)
+		if err != nil {
+			log.Fatal("Exiting: ", err)
+		}
+		hostname, _ := os.Hostname()
+		resource := otlpResource(siadAddress, *otlpNetwork, hostname, enabledCollectors(module), attributes)
+		otlp, err := newOTLPSink(*otlpEndpoint, *otlpProtocol, *otlpInsecure, resource)
+		if err != nil {
+			log.Fatal("Exiting: ", err)
+		}
+		log.Info("Exporting metrics over OTLP to ", *otlpEndpoint)
+		sinks = append(sinks, otlp)
+	}
+	if *statsdAddr != "" {
+		log.Info("Emitting metrics to StatsD at ", *statsdAddr)
+		sinks = append(sinks, newStatsdSink(*statsdAddr))
+	}
+
+	intervals, err := parseModuleIntervals(*moduleRefresh)
+	if err != nil {
+		log.Fatal("Exiting: ", err)
+	}
 
 	// Set the metrics initially before starting the monitor and HTTP server
 	// If you don't do this all the metrics start with a "0" until they are set
-	updateMetrics(sc)
-
-	// start the metrics collector
-	go startMonitor(time.Duration(*refresh), sc)
+	sleepJitter(ctx, *jitter)
+	log.Debug("Updating exchange rate")
+	updateExchangeRate()
+	updateMetrics(ctx, client, enabledCollectors(module))
+	sendToSinks(ctx)
 
 	// This section will start the HTTP server and expose
 	// any metrics on the /metrics endpoint.
-	http.Handle("/metrics", promhttp.Handler())
-	log.Info("Beginning to metrics at http://<your ip address>:", *port, "/metrics")
-	log.Fatal(http.ListenAndServe(":"+strconv.Itoa(*port), nil))
+	var handler http.Handler = newCollectorsHandler(newHandler)
+	var influx http.Handler = influxHandler(sinkGatherer)
+	if *onScrape {
+		handler = collectOnScrape(handler, client)
+		influx = collectOnScrape(influx, client)
+	}
+	http.Handle("/metrics", handler)
+	http.Handle("/influx", influx)
+	http.HandleFunc("/status.json", statusJSONHandler)
+	http.HandleFunc("/healthz", healthzHandler)
+	http.Handle("/readyz", ready)
+	http.HandleFunc("/", statusHTMLHandler)
+	addresses := listenAddresses(*listenAddress, *port)
+	var names []string
+	for _, c := range enabledCollectors(module) {
+		names = append(names, c.name)
+	}
+	log.Info("Enabled collectors: ", strings.Join(names, ", "))
+	log.Info("Beginning to serve metrics at ", strings.Join(addresses, ", "), " on /metrics")
+	sched := newSchedule(enabledCollectors(module), time.Duration(refresh), intervals, *maxBackoff, time.Now())
+	if err := run(ctx, client, sched, addresses, *webConfig, *shutdownTimeout); err != nil {
+		log.Fatal("Exiting: ", err)
+	}
+	log.Info("Exited")
 }
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/proto"
+)
+
+// legacyName is the name a metric had before metric names got the sia_
+// namespace and unit suffixes.
+type legacyName struct {
+	name   string
+	legacy string
+	// scale converts the value of the metric to the unit of the legacy
+	// metric. 0 means the units are the same.
+	scale float64
+	// floor rounds the scaled value down, for legacy metrics that were
+	// computed with integer division.
+	floor bool
+}
+
+// legacyNames lists the legacy names of the metrics. The fiat mirrors of
+// siacoin metrics are renamed along with them, see fiatLegacyNames.
+var legacyNames = []legacyName{
+	{"sia_renter_aggregate_num_files", "renter_aggregate_num_files", 0, false},
+	{"sia_renter_aggregate_num_stuck_chunks", "renter_aggregate_num_stuck_chunks", 0, false},
+	{"sia_renter_aggregate_size_bytes", "renter_aggregate_size", 0, false},
+	{"sia_renter_max_health", "renter_max_health", 0, false},
+	{"sia_renter_max_health_aggregated_percentage", "renter_max_health_aggregated_percentage", 0, false},
+	{"sia_renter_min_redundancy", "renter_min_redundancy", 0, false},
+	{"sia_renter_min_redundancy_aggregated", "renter_min_redundancy_aggregated", 0, false},
+	{"sia_renter_rate_limit_download_bytes_per_second", "renter_rate_limit_download", 0, false},
+	{"sia_renter_rate_limit_upload_bytes_per_second", "renter_rate_limit_upload", 0, false},
+	{"sia_renter_num_active_contracts", "renter_num_active_contracts", 0, false},
+	{"sia_renter_num_disabled_contracts", "renter_num_disabled_contracts", 0, false},
+	{"sia_renter_num_refreshed_contracts", "renter_num_refreshed_contracts", 0, false},
+	{"sia_renter_num_passive_contracts", "renter_num_passive_contracts", 0, false},
+	{"sia_renter_num_expired_contracts", "renter_num_expired_contracts", 0, false},
+	{"sia_renter_num_expired_refreshed_contracts", "renter_num_expired_refreshed_contracts", 0, false},
+	{"sia_renter_allowance_amount_siacoins", "renter_allowance_amount", 0, false},
+	{"sia_renter_allowance_period_blocks", "renter_allowance_period", 0, false},
+	{"sia_renter_allowance_renew_window_blocks", "renter_allowance_renew_window", 0, false},
+	{"sia_renter_allowance_hosts", "renter_allowance_hosts", 0, false},
+	{"sia_renter_allowance_current_spent_siacoins", "renter_allowance_current_spent", 0, false},
+	{"sia_renter_allowance_current_unspent_siacoins", "renter_allowance_current_unspent", 0, false},
+	{"sia_renter_allowance_current_storage_siacoins", "renter_allowance_current_storage", 0, false},
+	{"sia_renter_allowance_current_upload_siacoins", "renter_allowance_current_upload", 0, false},
+	{"sia_renter_allowance_current_download_siacoins", "renter_allowance_current_download", 0, false},
+	{"sia_renter_allowance_current_fees_siacoins", "renter_allowance_current_fees", 0, false},
+	{"sia_renter_allowance_current_unspent_allocated_siacoins", "renter_allowance_current_unspent_allocated", 0, false},
+	{"sia_renter_allowance_current_unspent_unallocated_siacoins", "renter_allowance_current_unspent_unallocated", 0, false},
+	{"sia_consensus_synced", "consensus_synced", 0, false},
+	{"sia_consensus_height", "consensus_height", 0, false},
+	{"sia_consensus_difficulty", "consensus_difficulty", 0, false},
+	{"sia_global_rate_limit_download_bytes_per_second", "global_rate_limit_download", 0, false},
+	{"sia_global_rate_limit_upload_bytes_per_second", "global_rate_limit_upload", 0, false},
+	{"sia_wallet_locked", "wallet_locked", 0, false},
+	{"sia_wallet_confirmed_siacoin_balance_hastings", "wallet_confirmed_siacoin_balance_hastings", 0, false},
+	{"sia_wallet_confirmed_siacoin_balance_siacoins", "wallet_confirmed_siacoin_balance", 0, false},
+	{"sia_wallet_siafund_balance", "wallet_siafund_balance", 0, false},
+	{"sia_wallet_siafund_claim_balance_hastings", "wallet_siafund_claim_balance", 0, false},
+	{"sia_wallet_num_addresses", "wallet_num_addresses", 0, false},
+	{"sia_gateway_num_peers", "gateway_num_peers", 0, false},
+	{"sia_gateway_rate_limit_download_bytes_per_second", "gateway_rate_limit_download", 0, false},
+	{"sia_gateway_rate_limit_upload_bytes_per_second", "gateway_rate_limit_upload", 0, false},
+	{"sia_hostdb_num_all_hosts", "hostdb_num_all_hosts", 0, false},
+	{"sia_hostdb_num_active_hosts", "hostdb_num_active_hosts", 0, false},
+	{"sia_hostdb_num_inactive_hosts", "hostdb_num_inactive_hosts", 0, false},
+	{"sia_hostdb_num_offline_hosts", "hostdb_num_offline_hosts", 0, false},
+	{"sia_host_accepting_contracts", "host_accepting_contracts", 0, false},
+	{"sia_host_max_duration_blocks", "host_max_duration", 0, false},
+	{"sia_host_max_download_batch_size_bytes", "host_max_download_batch_size", 0, false},
+	{"sia_host_max_revise_batch_size_bytes", "host_max_revise_batch_size", 0, false},
+	// The window size was exported in whole hours
+	{"sia_host_window_size_blocks", "host_window_size", 1.0 / 6, true},
+	{"sia_host_collateral_per_tb_month_siacoins", "host_collateral", 0, false},
+	{"sia_host_collateral_budget_siacoins", "host_collateral_budget", 0, false},
+	{"sia_host_max_collateral_siacoins", "host_max_collateral", 0, false},
+	{"sia_host_revenue_siacoins", "host_revenue", 0, false},
+	{"sia_host_potential_revenue_siacoins", "host_potential_revenue", 0, false},
+	{"sia_host_contract_count", "host_contract_count", 0, false},
+	{"sia_host_total_storage_bytes", "host_total_storage", 0, false},
+	{"sia_host_remaining_storage_bytes", "host_remaining_storage", 0, false},
+}
+
+// fiatLegacyNames returns the legacy names of the fiat mirrors of the siacoin
+// metrics in legacyNames.
+func fiatLegacyNames() []legacyName {
+	var names []legacyName
+	for _, n := range legacyNames {
+		if strings.HasSuffix(n.name, "_siacoins") {
+			names = append(names, legacyName{
+				name:   strings.TrimSuffix(n.name, "_siacoins") + "_fiat",
+				legacy: n.legacy + "_fiat",
+			})
+		}
+	}
+	return names
+}
+
+// loadedLegacyModules lists the modules whose sia_module_loaded series is
+// also exported as <module>_module_loaded, the gauge their collectors set
+// before siad was asked for its modules.
+var loadedLegacyModules = []string{"renter", "consensus", "wallet", "gateway"}
+
+// loadedLegacyFamilies returns the <module>_module_loaded families of the
+// series of the sia_module_loaded family mf.
+func loadedLegacyFamilies(mf *dto.MetricFamily) []*dto.MetricFamily {
+	var legacy []*dto.MetricFamily
+	for _, m := range mf.Metric {
+		var module string
+		for _, l := range m.Label {
+			if l.GetName() == "module" {
+				module = l.GetValue()
+			}
+		}
+		for _, lm := range loadedLegacyModules {
+			if module != lm {
+				continue
+			}
+			legacy = append(legacy, &dto.MetricFamily{
+				Name:   proto.String(module + "_module_loaded"),
+				Help:   proto.String(fmt.Sprintf("Is the %v module loaded. 0=not loaded.  1=loaded (deprecated, use %v{module=%q})", module, mf.GetName(), module)),
+				Type:   dto.MetricType_GAUGE.Enum(),
+				Metric: []*dto.Metric{{Gauge: &dto.Gauge{Value: proto.Float64(m.GetGauge().GetValue())}}},
+			})
+		}
+	}
+	return legacy
+}
+
+// legacyGatherer is a Gatherer that also exports the metrics gathered by
+// another Gatherer under their legacy names, so that dashboards and alerts
+// keep working while they are migrated to the new names.
+type legacyGatherer struct {
+	prometheus.Gatherer
+}
+
+// legacyNamesByName indexes legacyNames and fiatLegacyNames by metric name.
+var legacyNamesByName = func() map[string]legacyName {
+	m := make(map[string]legacyName)
+	for _, n := range append(legacyNames, fiatLegacyNames()...) {
+		m[n.name] = n
+	}
+	return m
+}()
+
+// Gather implements prometheus.Gatherer.
+func (g legacyGatherer) Gather() ([]*dto.MetricFamily, error) {
+	mfs, err := g.Gatherer.Gather()
+	var legacy []*dto.MetricFamily
+	for _, mf := range mfs {
+		if mf.GetName() == "sia_module_loaded" {
+			legacy = append(legacy, loadedLegacyFamilies(mf)...)
+			continue
+		}
+		n, ok := legacyNamesByName[mf.GetName()]
+		if !ok {
+			continue
+		}
+		lmf := proto.Clone(mf).(*dto.MetricFamily)
+		lmf.Name = proto.String(n.legacy)
+		lmf.Help = proto.String(fmt.Sprintf("%v (deprecated, use %v)", mf.GetHelp(), n.name))
+		if n.scale != 0 {
+			for _, m := range lmf.Metric {
+				if m.Gauge == nil {
+					continue
+				}
+				v := m.Gauge.GetValue() * n.scale
+				if n.floor {
+					v = math.Floor(v)
+				}
+				m.Gauge.Value = proto.Float64(v)
+			}
+		}
+		legacy = append(legacy, lmf)
+	}
+	mfs = append(mfs, legacy...)
+	sort.Slice(mfs, func(i, j int) bool { return mfs[i].GetName() < mfs[j].GetName() })
+	return mfs, err
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/sirupsen/logrus"
+)
+
+func TestLegacyNames(t *testing.T) {
+	log = logrus.New()
+	log.SetOutput(ioutil.Discard)
+	defer func() { rateSource, rateKnown = nil, false }()
+	fiatCurrency, rateSource = "usd", staticRate(0.01)
+	updateExchangeRate()
+
+	siad := newFakeSiad(scenarioDir("default"))
+	defer siad.Close()
+	resetAllModuleMetrics()
+	defer func() { loadedModules = nil }()
+	discoverModules(context.Background(), fakeClient(siad.URL))
+	collect(context.Background(), fakeClient(siad.URL), moduleCollectors)
+
+	// Every module metric has a legacy name and every legacy name belongs to
+	// a module metric
+	mfs, err := moduleRegistry().Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lmfs, err := legacyGatherer{moduleRegistry()}.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	deprecated := make(map[string]bool)
+	for _, mf := range lmfs {
+		if i := strings.Index(mf.GetHelp(), "(deprecated, use "); i >= 0 {
+			name := strings.TrimSuffix(mf.GetHelp()[i+len("(deprecated, use "):], ")")
+			deprecated[strings.SplitN(name, "{", 2)[0]] = true
+		}
+	}
+	gathered := make(map[string]bool)
+	for _, mf := range mfs {
+		gathered[mf.GetName()] = true
+		if !deprecated[mf.GetName()] {
+			t.Errorf("legacy name of %v is missing", mf.GetName())
+		}
+	}
+	for name := range legacyNamesByName {
+		if !gathered[name] {
+			t.Errorf("legacy name of %v belongs to no metric", name)
+		}
+	}
+
+	mfs = lmfs
+	values := make(map[string]float64)
+	for i, mf := range mfs {
+		if i > 0 && mfs[i-1].GetName() >= mf.GetName() {
+			t.Errorf("metric families were not sorted. %v before %v", mfs[i-1].GetName(), mf.GetName())
+		}
+		values[mf.GetName()] = mf.GetMetric()[0].GetGauge().GetValue()
+	}
+	expected := map[string]float64{
+		"sia_host_window_size_blocks":               144,
+		"host_window_size":                          24,
+		"sia_host_revenue_siacoins":                 900,
+		"host_revenue":                              900,
+		"sia_host_revenue_fiat":                     9,
+		"host_revenue_fiat":                         9,
+		"wallet_confirmed_siacoin_balance":          1234.5,
+		"sia_renter_aggregate_size_bytes":           123456789,
+		"renter_aggregate_size":                     123456789,
+		"global_rate_limit_upload":                  5e6,
+		"sia_wallet_siafund_balance":                0,
+		"wallet_confirmed_siacoin_balance_hastings": 1.2345e27,
+		"renter_module_loaded":                      1,
+		"wallet_module_loaded":                      1,
+	}
+	for name, value := range expected {
+		if v, ok := values[name]; !ok || v != value {
+			t.Errorf("value of %v was incorrect. expected %v got %v", name, value, v)
+		}
+	}
+}
+
+// metricsDoc returns the table of metric names in METRICS.md.
+func metricsDoc() []byte {
+	names := append(append([]legacyName(nil), legacyNames...), fiatLegacyNames()...)
+	for _, module := range loadedLegacyModules {
+		names = append(names, legacyName{name: fmt.Sprintf("sia_module_loaded{module=%q}", module), legacy: module + "_module_loaded"})
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i].name < names[j].name })
+
+	var buf bytes.Buffer
+	fmt.Fprintln(&buf, "# Metric names")
+	fmt.Fprintln(&buf)
+	fmt.Fprintln(&buf, "<!-- Generated from naming.go by `go test -run TestMetricsDoc -args -update`, do not edit. -->")
+	fmt.Fprintln(&buf)
+	fmt.Fprintln(&buf, "The metrics of the Sia modules are named `sia_<module>_<name>`, ending in their")
+	fmt.Fprintln(&buf, "unit where they have one. Unless `-metrics.legacy-names=false` is set they are")
+	fmt.Fprintln(&buf, "also exported under their legacy names, which will be removed in a future")
+	fmt.Fprintln(&buf, "release.")
+	fmt.Fprintln(&buf)
+	fmt.Fprintln(&buf, "| Metric | Unit | Legacy name |")
+	fmt.Fprintln(&buf, "| --- | --- | --- |")
+	for _, n := range names {
+		name := n.name
+		unit := metricUnit(&dto.MetricFamily{Name: &name, Type: dto.MetricType_GAUGE.Enum()})
+		legacy := "`" + n.legacy + "`"
+		if n.scale != 0 {
+			legacy += fmt.Sprintf(" (value × 1/%v)", 1/n.scale)
+		}
+		fmt.Fprintf(&buf, "| `%v` | %v | %v |\n", n.name, unit, legacy)
+	}
+	return buf.Bytes()
+}
+
+func TestMetricsDoc(t *testing.T) {
+	if *update {
+		if err := ioutil.WriteFile("METRICS.md", metricsDoc(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b, err := ioutil.ReadFile("METRICS.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, metricsDoc()) {
+		t.Errorf("METRICS.md is out of date, regenerate it with go test -run TestMetricsDoc -args -update")
+	}
+}
+
+func TestLegacyWindowSize(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	g := prometheus.NewGauge(prometheus.GaugeOpts{Name: "sia_host_window_size_blocks", Help: "test"})
+	g.Set(145)
+	reg.MustRegister(g)
+	mfs, err := legacyGatherer{reg}.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range mfs {
+		if mf.GetName() == "host_window_size" {
+			if v := mf.GetMetric()[0].GetGauge().GetValue(); v != 24 {
+				t.Errorf("host_window_size was incorrect. expected %v got %v", 24, v)
+			}
+			return
+		}
+	}
+	t.Errorf("host_window_size was incorrect. expected it to be gathered")
+}
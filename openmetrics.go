@@ -0,0 +1,97 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// metricUnits are the units exposed as metadata in the OpenMetrics format and
+// sent to the remote_write and OTLP sinks. OpenMetrics requires the unit to be
+// the suffix of the metric name, so the unit of a metric is taken from its
+// name.
+var metricUnits = []string{"seconds", "bytes", "siacoins", "blocks"}
+
+// metricUnit returns the unit of a metric family, or "" if its name does not
+// end in one of the metricUnits.
+func metricUnit(mf *dto.MetricFamily) string {
+	name := mf.GetName()
+	if mf.GetType() == dto.MetricType_COUNTER {
+		name = strings.TrimSuffix(name, "_total")
+	}
+	for _, unit := range metricUnits {
+		if strings.HasSuffix(name, "_"+unit) {
+			return unit
+		}
+	}
+	return ""
+}
+
+// unitGatherer is a Gatherer that sets the units of the metric families
+// gathered by another Gatherer.
+type unitGatherer struct {
+	prometheus.Gatherer
+}
+
+// Gather implements prometheus.Gatherer.
+func (g unitGatherer) Gather() ([]*dto.MetricFamily, error) {
+	mfs, err := g.Gatherer.Gather()
+	for _, mf := range mfs {
+		if unit := metricUnit(mf); unit != "" {
+			mf.Unit = &unit
+		}
+	}
+	return mfs, err
+}
+
+// openMetricsHandler serves the metrics of a Gatherer in the OpenMetrics
+// format with units, created timestamps of counters and exemplars. promhttp
+// does not write units, so OpenMetrics is encoded here, and all other formats
+// are served by next.
+type openMetricsHandler struct {
+	gatherer prometheus.Gatherer
+	next     http.Handler
+}
+
+// newMetricsHandler creates a handler serving the metrics of g in the format
+// negotiated with the scraper.
+func newMetricsHandler(g prometheus.Gatherer) http.Handler {
+	g = unitGatherer{g}
+	return promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer, openMetricsHandler{
+		gatherer: g,
+		next:     promhttp.HandlerFor(g, promhttp.HandlerOpts{ErrorLog: log}),
+	})
+}
+
+// ServeHTTP implements http.Handler.
+func (h openMetricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	format := expfmt.NegotiateIncludingOpenMetrics(r.Header)
+	if format.FormatType() != expfmt.TypeOpenMetrics {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+
+	mfs, err := h.gatherer.Gather()
+	if err != nil {
+		log.Warn("Error gathering metrics: ", err)
+		if len(mfs) == 0 {
+			http.Error(w, "An error has occurred while gathering metrics:\n\n"+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", string(format))
+	enc := expfmt.NewEncoder(w, format, expfmt.WithUnit(), expfmt.WithCreatedLines())
+	for _, mf := range mfs {
+		if err := enc.Encode(mf); err != nil {
+			log.Warn("Error encoding metrics: ", err)
+			return
+		}
+	}
+	if closer, ok := enc.(expfmt.Closer); ok {
+		closer.Close()
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/sirupsen/logrus"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	log = logrus.New()
+
+	reg := prometheus.NewRegistry()
+	size := promauto.With(reg).NewGauge(prometheus.GaugeOpts{Name: "test_size_bytes", Help: "Test size"})
+	size.Set(42)
+	promauto.With(reg).NewGauge(prometheus.GaugeOpts{Name: "test_height", Help: "Test height"}).Set(7)
+	calls := promauto.With(reg).NewCounter(prometheus.CounterOpts{Name: "test_calls_total", Help: "Test calls"})
+	calls.(prometheus.ExemplarAdder).AddWithExemplar(1, prometheus.Labels{"call_id": "0123456789abcdef"})
+	h := newMetricsHandler(reg)
+
+	tests := []struct {
+		accept   string
+		contains []string
+		missing  []string
+	}{
+		{
+			accept: "application/openmetrics-text; version=1.0.0",
+			contains: []string{
+				"# UNIT test_size_bytes bytes\n",
+				"test_size_bytes 42.0\n",
+				"test_height 7.0\n",
+				"test_calls_created ",
+				`test_calls_total 1.0 # {call_id="0123456789abcdef"} 1.0`,
+				"# EOF\n",
+			},
+			missing: []string{"# UNIT test_height"},
+		},
+		{
+			accept:   "text/plain",
+			contains: []string{"test_size_bytes 42\n", "test_calls_total 1\n"},
+			missing:  []string{"# UNIT", "# EOF", "call_id"},
+		},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/metrics", nil)
+		r.Header.Set("Accept", test.accept)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		b, _ := ioutil.ReadAll(w.Body)
+		body := string(b)
+		for _, s := range test.contains {
+			if !strings.Contains(body, s) {
+				t.Errorf("metrics in %v were incorrect. expected %q in\n%v", test.accept, s, body)
+			}
+		}
+		for _, s := range test.missing {
+			if strings.Contains(body, s) {
+				t.Errorf("metrics in %v were incorrect. expected no %q in\n%v", test.accept, s, body)
+			}
+		}
+	}
+}
+
+func TestRecordAPICallExemplar(t *testing.T) {
+	log = logrus.New()
+
+	recordAPICall("test_exemplar", "/consensus", "", nil)
+	m := &dto.Metric{}
+	if err := apiCalls.WithLabelValues("test_exemplar", "/consensus").Write(m); err != nil {
+		t.Fatal(err)
+	}
+	e := m.GetCounter().GetExemplar()
+	if e == nil || len(e.GetLabel()) != 1 || e.GetLabel()[0].GetName() != "call_id" || len(e.GetLabel()[0].GetValue()) != 16 {
+		t.Errorf("exemplar was incorrect. expected a call_id got %v", e)
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// OTLP transport protocols.
+const (
+	otlpProtocolHTTP = "http/protobuf"
+	otlpProtocolGRPC = "grpc"
+)
+
+// otlpUnits are the UCUM units of the metricUnits.
+var otlpUnits = map[string]string{
+	"seconds":  "s",
+	"bytes":    "By",
+	"siacoins": "{siacoin}",
+	"blocks":   "{block}",
+}
+
+// otlpSink exports the metrics to an OpenTelemetry Collector, or any other
+// OTLP receiver, over HTTP or gRPC.
+type otlpSink struct {
+	endpoint string
+	protocol string
+	insecure bool
+	resource *resourcepb.Resource
+	client   *http.Client
+
+	// conn is the gRPC connection, dialed on the first export.
+	mu   sync.Mutex
+	conn *grpc.ClientConn
+}
+
+// newOTLPSink creates an otlpSink exporting with protocol to endpoint, which
+// is the URL of the metrics path for HTTP, e.g.
+// http://collector:4318/v1/metrics, and host:port for gRPC. insecure disables
+// TLS for gRPC. attributes describe the resource the metrics belong to.
+func newOTLPSink(endpoint, protocol string, insecure bool, attributes map[string]string) (*otlpSink, error) {
+	if protocol != otlpProtocolHTTP && protocol != otlpProtocolGRPC {
+		return nil, fmt.Errorf("invalid OTLP protocol %q, must be %v or %v", protocol, otlpProtocolHTTP, otlpProtocolGRPC)
+	}
+	return &otlpSink{
+		endpoint: endpoint,
+		protocol: protocol,
+		insecure: insecure,
+		resource: &resourcepb.Resource{Attributes: otlpAttributes(attributes)},
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// Name implements sink.
+func (s *otlpSink) Name() string {
+	return "otlp"
+}
+
+// Send implements sink.
+func (s *otlpSink) Send(ctx context.Context, mfs []*dto.MetricFamily) error {
+	req := &colmetricspb.ExportMetricsServiceRequest{ResourceMetrics: []*metricspb.ResourceMetrics{{
+		Resource: s.resource,
+		ScopeMetrics: []*metricspb.ScopeMetrics{{
+			Scope:   &commonpb.InstrumentationScope{Name: "github.com/tbenz9/sia_exporter"},
+			Metrics: otlpMetrics(mfs, time.Now()),
+		}},
+	}}}
+	if s.protocol == otlpProtocolGRPC {
+		return retry(ctx, func() error { return s.exportGRPC(ctx, req) })
+	}
+	body, err := proto.Marshal(req)
+	if err != nil {
+		return err
+	}
+	return retry(ctx, func() error { return s.exportHTTP(ctx, body) })
+}
+
+// Close closes the gRPC connection.
+func (s *otlpSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+// exportHTTP posts an encoded ExportMetricsServiceRequest.
+func (s *otlpSink) exportHTTP(ctx context.Context, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return permanentError{err}
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return classifyHTTPStatus(resp)
+}
+
+// exportGRPC calls the Export method of the metrics service.
+func (s *otlpSink) exportGRPC(ctx context.Context, req *colmetricspb.ExportMetricsServiceRequest) error {
+	s.mu.Lock()
+	if s.conn == nil {
+		creds := credentials.NewTLS(nil)
+		if s.insecure {
+			creds = insecure.NewCredentials()
+		}
+		conn, err := grpc.NewClient(s.endpoint, grpc.WithTransportCredentials(creds))
+		if err != nil {
+			s.mu.Unlock()
+			return permanentError{err}
+		}
+		s.conn = conn
+	}
+	conn := s.conn
+	s.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	_, err := colmetricspb.NewMetricsServiceClient(conn).Export(ctx, req)
+	switch status.Code(err) {
+	case codes.OK, codes.Canceled, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted,
+		codes.OutOfRange, codes.Unavailable, codes.DataLoss:
+		// Retryable according to the OTLP specification
+		return err
+	}
+	return permanentError{err}
+}
+
+// otlpAttributes converts attributes to OTLP key values, sorted by key.
+func otlpAttributes(attributes map[string]string) []*commonpb.KeyValue {
+	kvs := make([]*commonpb.KeyValue, 0, len(attributes))
+	for k, v := range attributes {
+		kvs = append(kvs, &commonpb.KeyValue{Key: k, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v}}})
+	}
+	sort.Slice(kvs, func(i, j int) bool { return kvs[i].Key < kvs[j].Key })
+	return kvs
+}
+
+// otlpLabels converts the labels of a metric to OTLP attributes.
+func otlpLabels(labels []*dto.LabelPair) []*commonpb.KeyValue {
+	attributes := make(map[string]string, len(labels))
+	for _, lp := range labels {
+		attributes[lp.GetName()] = lp.GetValue()
+	}
+	return otlpAttributes(attributes)
+}
+
+// otlpMetrics converts the metric families to OTLP metrics at ts. Gauges and
+// untyped metrics become gauges, counters monotonic cumulative sums starting
+// at their created timestamp, histograms cumulative histograms and summaries
+// summaries. The unit is taken from the name like for OpenMetrics.
+func otlpMetrics(mfs []*dto.MetricFamily, ts time.Time) []*metricspb.Metric {
+	now := uint64(ts.UnixNano())
+	metrics := make([]*metricspb.Metric, 0, len(mfs))
+	for _, mf := range mfs {
+		metric := &metricspb.Metric{
+			Name:        mf.GetName(),
+			Description: mf.GetHelp(),
+			Unit:        otlpUnits[metricUnit(mf)],
+		}
+		switch mf.GetType() {
+		case dto.MetricType_COUNTER:
+			sum := &metricspb.Sum{IsMonotonic: true, AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE}
+			for _, m := range mf.GetMetric() {
+				p := &metricspb.NumberDataPoint{
+					Attributes:   otlpLabels(m.GetLabel()),
+					TimeUnixNano: now,
+					Value:        &metricspb.NumberDataPoint_AsDouble{AsDouble: m.GetCounter().GetValue()},
+				}
+				if created := m.GetCounter().GetCreatedTimestamp(); created != nil {
+					p.StartTimeUnixNano = uint64(created.AsTime().UnixNano())
+				}
+				sum.DataPoints = append(sum.DataPoints, p)
+			}
+			metric.Data = &metricspb.Metric_Sum{Sum: sum}
+		case dto.MetricType_HISTOGRAM:
+			hist := &metricspb.Histogram{AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE}
+			for _, m := range mf.GetMetric() {
+				h := m.GetHistogram()
+				sum := h.GetSampleSum()
+				p := &metricspb.HistogramDataPoint{
+					Attributes:   otlpLabels(m.GetLabel()),
+					TimeUnixNano: now,
+					Count:        h.GetSampleCount(),
+					Sum:          &sum,
+				}
+				if created := h.GetCreatedTimestamp(); created != nil {
+					p.StartTimeUnixNano = uint64(created.AsTime().UnixNano())
+				}
+				// OTLP bucket counts are not cumulative and end with the
+				// count of the implicit +Inf bucket
+				var last uint64
+				for _, b := range h.GetBucket() {
+					if math.IsInf(b.GetUpperBound(), 1) {
+						continue
+					}
+					p.ExplicitBounds = append(p.ExplicitBounds, b.GetUpperBound())
+					p.BucketCounts = append(p.BucketCounts, b.GetCumulativeCount()-last)
+					last = b.GetCumulativeCount()
+				}
+				p.BucketCounts = append(p.BucketCounts, h.GetSampleCount()-last)
+				hist.DataPoints = append(hist.DataPoints, p)
+			}
+			metric.Data = &metricspb.Metric_Histogram{Histogram: hist}
+		case dto.MetricType_SUMMARY:
+			summary := &metricspb.Summary{}
+			for _, m := range mf.GetMetric() {
+				s := m.GetSummary()
+				p := &metricspb.SummaryDataPoint{
+					Attributes:   otlpLabels(m.GetLabel()),
+					TimeUnixNano: now,
+					Count:        s.GetSampleCount(),
+					Sum:          s.GetSampleSum(),
+				}
+				for _, q := range s.GetQuantile() {
+					p.QuantileValues = append(p.QuantileValues, &metricspb.SummaryDataPoint_ValueAtQuantile{Quantile: q.GetQuantile(), Value: q.GetValue()})
+				}
+				summary.DataPoints = append(summary.DataPoints, p)
+			}
+			metric.Data = &metricspb.Metric_Summary{Summary: summary}
+		default:
+			gauge := &metricspb.Gauge{}
+			for _, m := range mf.GetMetric() {
+				value := m.GetGauge().GetValue()
+				if mf.GetType() == dto.MetricType_UNTYPED {
+					value = m.GetUntyped().GetValue()
+				}
+				gauge.DataPoints = append(gauge.DataPoints, &metricspb.NumberDataPoint{
+					Attributes:   otlpLabels(m.GetLabel()),
+					TimeUnixNano: now,
+					Value:        &metricspb.NumberDataPoint_AsDouble{AsDouble: value},
+				})
+			}
+			metric.Data = &metricspb.Metric_Gauge{Gauge: gauge}
+		}
+		metrics = append(metrics, metric)
+	}
+	return metrics
+}
+
+// otlpResource returns the resource attributes of the exported metrics: the
+// exporter as service, the Sia node and network it monitors and the modules
+// it collects, overridden by the attributes set by the user.
+func otlpResource(address, network, hostname string, collectors []moduleCollector, attributes map[string]string) map[string]string {
+	var modules []string
+	for _, c := range collectors {
+		modules = append(modules, c.name)
+	}
+	resource := map[string]string{
+		"service.name":        "sia_exporter",
+		"service.instance.id": hostname,
+		"sia.node.address":    address,
+		"sia.network":         network,
+		"sia.modules":         strings.Join(modules, ","),
+	}
+	for k, v := range attributes {
+		resource[k] = v
+	}
+	return resource
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/sirupsen/logrus"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+// otlpTestMetrics gathers a gauge, a counter and a histogram.
+func otlpTestMetrics(t *testing.T) []*dto.MetricFamily {
+	reg := prometheus.NewRegistry()
+	allowance := prometheus.NewGauge(prometheus.GaugeOpts{Name: "sia_renter_allowance_amount_siacoins", Help: "Allowance"})
+	allowance.Set(500)
+	errs := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "sia_exporter_api_errors_total", Help: "Errors"}, []string{"module"})
+	errs.WithLabelValues("renter").Add(2)
+	h := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "sia_exporter_collect_duration_seconds", Help: "Duration", Buckets: []float64{1, 5}})
+	h.Observe(0.5)
+	h.Observe(2)
+	h.Observe(10)
+	reg.MustRegister(allowance, errs, h)
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mfs
+}
+
+func TestOTLPMetrics(t *testing.T) {
+	metrics := otlpTestMetrics(t)
+	byName := make(map[string]*metricspb.Metric)
+	for _, m := range otlpMetrics(metrics, time.Unix(1600000000, 0)) {
+		byName[m.GetName()] = m
+	}
+
+	allowance := byName["sia_renter_allowance_amount_siacoins"]
+	if allowance.GetUnit() != "{siacoin}" || allowance.GetGauge().GetDataPoints()[0].GetAsDouble() != 500 {
+		t.Errorf("allowance was incorrect. expected gauge of 500 {siacoin} got %v", allowance)
+	}
+
+	errs := byName["sia_exporter_api_errors_total"]
+	p := errs.GetSum().GetDataPoints()[0]
+	if !errs.GetSum().GetIsMonotonic() || p.GetAsDouble() != 2 || p.GetAttributes()[0].GetValue().GetStringValue() != "renter" {
+		t.Errorf("errors were incorrect. expected monotonic sum of 2 for renter got %v", errs)
+	}
+	if p.GetStartTimeUnixNano() == 0 || p.GetTimeUnixNano() != 1600000000000000000 {
+		t.Errorf("errors were incorrect. expected start and time got %v %v", p.GetStartTimeUnixNano(), p.GetTimeUnixNano())
+	}
+
+	duration := byName["sia_exporter_collect_duration_seconds"]
+	hp := duration.GetHistogram().GetDataPoints()[0]
+	counts := hp.GetBucketCounts()
+	if duration.GetUnit() != "s" || hp.GetCount() != 3 || len(counts) != 3 || counts[0] != 1 || counts[1] != 1 || counts[2] != 1 {
+		t.Errorf("duration was incorrect. expected bucket counts [1 1 1] in s got %v", duration)
+	}
+}
+
+func TestOTLPResource(t *testing.T) {
+	resource := otlpResource("127.0.0.1:9980", "mainnet", "node1", enabledCollectors("cw"), map[string]string{"sia.network": "zen"})
+	expected := map[string]string{
+		"service.name":        "sia_exporter",
+		"service.instance.id": "node1",
+		"sia.node.address":    "127.0.0.1:9980",
+		"sia.network":         "zen",
+		"sia.modules":         "daemon,consensus,wallet",
+	}
+	for k, v := range expected {
+		if resource[k] != v {
+			t.Errorf("resource attribute %v was incorrect. expected %v got %v", k, v, resource[k])
+		}
+	}
+}
+
+func TestOTLPSinkHTTP(t *testing.T) {
+	log = logrus.New()
+	log.SetOutput(ioutil.Discard)
+	var received colmetricspb.ExportMetricsServiceRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		if r.URL.Path != "/v1/metrics" || r.Header.Get("Content-Type") != "application/x-protobuf" || proto.Unmarshal(b, &received) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	s, err := newOTLPSink(server.URL+"/v1/metrics", otlpProtocolHTTP, false, map[string]string{"service.name": "sia_exporter"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Send(context.Background(), otlpTestMetrics(t)); err != nil {
+		t.Fatal(err)
+	}
+	checkExport(t, &received)
+}
+
+// fakeMetricsService is a stand-in for the OTLP gRPC metrics service.
+type fakeMetricsService struct {
+	colmetricspb.UnimplementedMetricsServiceServer
+	received chan *colmetricspb.ExportMetricsServiceRequest
+}
+
+func (f *fakeMetricsService) Export(ctx context.Context, req *colmetricspb.ExportMetricsServiceRequest) (*colmetricspb.ExportMetricsServiceResponse, error) {
+	f.received <- req
+	return &colmetricspb.ExportMetricsServiceResponse{}, nil
+}
+
+func TestOTLPSinkGRPC(t *testing.T) {
+	log = logrus.New()
+	log.SetOutput(ioutil.Discard)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := &fakeMetricsService{received: make(chan *colmetricspb.ExportMetricsServiceRequest, 1)}
+	server := grpc.NewServer()
+	colmetricspb.RegisterMetricsServiceServer(server, service)
+	go server.Serve(l)
+	defer server.Stop()
+
+	s, err := newOTLPSink(l.Addr().String(), otlpProtocolGRPC, true, map[string]string{"service.name": "sia_exporter"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Send(context.Background(), otlpTestMetrics(t)); err != nil {
+		t.Fatal(err)
+	}
+	checkExport(t, <-service.received)
+
+	if _, err := newOTLPSink(l.Addr().String(), "udp", true, nil); err == nil {
+		t.Errorf("newOTLPSink was incorrect. expected an error for protocol udp")
+	}
+}
+
+// checkExport checks the resource and the number of metrics of an export of
+// the otlpTestMetrics.
+func checkExport(t *testing.T, req *colmetricspb.ExportMetricsServiceRequest) {
+	rms := req.GetResourceMetrics()
+	if len(rms) != 1 || rms[0].GetResource().GetAttributes()[0].GetValue().GetStringValue() != "sia_exporter" {
+		t.Fatalf("resource was incorrect. expected service.name sia_exporter got %v", rms)
+	}
+	if n := len(rms[0].GetScopeMetrics()[0].GetMetrics()); n != 3 {
+		t.Errorf("number of metrics was incorrect. expected %v got %v", 3, n)
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"gitlab.com/NebulousLabs/Sia/build"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/node/api"
+)
+
+var (
+	authFailed = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "sia_exporter_api_auth_failed", Help: "Did siad reject the API password on the last authenticated call. 0=accepted.  1=rejected"})
+	passwordReloads = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "sia_exporter_api_password_reloads_total", Help: "Number of times a changed API password was read after siad rejected the old one"})
+)
+
+// findPassword returns the Sia API password, which is read from, in order:
+// passwordFile, the SIA_API_PASSWORD environment variable, the apipassword
+// file in SIA_DATA_DIR and the apipassword file in Sia's default data
+// directory.
+func findPassword(passwordFile string) (string, error) {
+	if passwordFile != "" {
+		return readPasswordFile(passwordFile)
+	}
+
+	// Check environment variables
+	if apiPassword := os.Getenv("SIA_API_PASSWORD"); apiPassword != "" {
+		return apiPassword, nil
+	}
+	if dir := os.Getenv("SIA_DATA_DIR"); dir != "" {
+		return readPasswordFile(filepath.Join(dir, "apipassword"))
+	}
+
+	// No password passed in, fetch the API Password
+	return build.APIPassword()
+}
+
+// readPasswordFile reads the API password from a file.
+func readPasswordFile(file string) (string, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// authClient is an apiClient that reads the API password again when siad
+// rejects it, so that the exporter keeps working after the password was
+// rotated.
+type authClient struct {
+	find func() (string, error)
+
+	mu     sync.RWMutex
+	client *siadClient
+}
+
+// newAuthClient creates an authClient calling siad with client and the
+// password returned by find. If no password is found the client goes on
+// without one until siad rejects it.
+func newAuthClient(client *siadClient, find func() (string, error)) *authClient {
+	pw, err := find()
+	if err != nil {
+		log.Warn("Error getting API Password: ", err)
+	}
+	return &authClient{find: find, client: client.withPassword(pw)}
+}
+
+// current returns the client with the current password.
+func (c *authClient) current() *siadClient {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.client
+}
+
+// reload reads the password again after siad rejected old, and returns
+// whether it changed since.
+func (c *authClient) reload(old string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.client.password != old {
+		// Already reloaded by a concurrent call
+		return true
+	}
+	pw, err := c.find()
+	if err != nil {
+		log.Warn("Error getting API Password: ", err)
+		return false
+	}
+	if pw == old {
+		return false
+	}
+	log.Info("Read the changed API password after siad rejected the old one")
+	passwordReloads.Inc()
+	c.client = c.client.withPassword(pw)
+	return true
+}
+
+// call calls f with the current client, and once more if siad rejected the
+// password and it changed since.
+func (c *authClient) call(f func(sc *siadClient) error) error {
+	sc := c.current()
+	err := f(sc)
+	if err != nil && errorKind(err) == "auth" && c.reload(sc.password) {
+		err = f(c.current())
+	}
+	if err == nil {
+		authFailed.Set(0)
+	} else if errorKind(err) == "auth" {
+		authFailed.Set(1)
+	}
+	return err
+}
+
+// ConsensusGet implements apiClient.
+func (c *authClient) ConsensusGet(ctx context.Context) (cg api.ConsensusGET, err error) {
+	err = c.call(func(sc *siadClient) (err error) { cg, err = sc.ConsensusGet(ctx); return })
+	return
+}
+
+// DaemonSettingsGet implements apiClient.
+func (c *authClient) DaemonSettingsGet(ctx context.Context) (dg api.DaemonSettingsGet, err error) {
+	err = c.call(func(sc *siadClient) (err error) { dg, err = sc.DaemonSettingsGet(ctx); return })
+	return
+}
+
+// GatewayGet implements apiClient.
+func (c *authClient) GatewayGet(ctx context.Context) (gg api.GatewayGET, err error) {
+	err = c.call(func(sc *siadClient) (err error) { gg, err = sc.GatewayGet(ctx); return })
+	return
+}
+
+// HostGet implements apiClient.
+func (c *authClient) HostGet(ctx context.Context) (hg api.HostGET, err error) {
+	err = c.call(func(sc *siadClient) (err error) { hg, err = sc.HostGet(ctx); return })
+	return
+}
+
+// HostStorageGet implements apiClient.
+func (c *authClient) HostStorageGet(ctx context.Context) (sg api.StorageGET, err error) {
+	err = c.call(func(sc *siadClient) (err error) { sg, err = sc.HostStorageGet(ctx); return })
+	return
+}
+
+// HostDbAllGet implements apiClient.
+func (c *authClient) HostDbAllGet(ctx context.Context) (hdg api.HostdbAllGET, err error) {
+	err = c.call(func(sc *siadClient) (err error) { hdg, err = sc.HostDbAllGet(ctx); return })
+	return
+}
+
+// RenterGet implements apiClient.
+func (c *authClient) RenterGet(ctx context.Context) (rg api.RenterGET, err error) {
+	err = c.call(func(sc *siadClient) (err error) { rg, err = sc.RenterGet(ctx); return })
+	return
+}
+
+// RenterDisabledContractsGet implements apiClient.
+func (c *authClient) RenterDisabledContractsGet(ctx context.Context) (rc api.RenterContracts, err error) {
+	err = c.call(func(sc *siadClient) (err error) { rc, err = sc.RenterDisabledContractsGet(ctx); return })
+	return
+}
+
+// RenterDirGet implements apiClient.
+func (c *authClient) RenterDirGet(ctx context.Context, siaPath modules.SiaPath) (rd api.RenterDirectory, err error) {
+	err = c.call(func(sc *siadClient) (err error) { rd, err = sc.RenterDirGet(ctx, siaPath); return })
+	return
+}
+
+// WalletGet implements apiClient.
+func (c *authClient) WalletGet(ctx context.Context) (wg api.WalletGET, err error) {
+	err = c.call(func(sc *siadClient) (err error) { wg, err = sc.WalletGet(ctx); return })
+	return
+}
+
+// WalletAddressesGet implements apiClient.
+func (c *authClient) WalletAddressesGet(ctx context.Context) (wag api.WalletAddressesGET, err error) {
+	err = c.call(func(sc *siadClient) (err error) { wag, err = sc.WalletAddressesGet(ctx); return })
+	return
+}
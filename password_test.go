@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+)
+
+func TestPasswordRotation(t *testing.T) {
+	log = logrus.New()
+	log.SetOutput(ioutil.Discard)
+	dir, err := ioutil.TempDir("", "sia_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "apipassword")
+	ioutil.WriteFile(file, []byte("old\n"), 0600)
+
+	siad := newFakeSiad(scenarioDir("default"))
+	defer siad.Close()
+	siad.setPassword("old")
+	c := newAuthClient(fakeClient(siad.URL), func() (string, error) { return findPassword(file) })
+	if _, err := c.ConsensusGet(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// A rotated password is read again
+	reloads := testutil.ToFloat64(passwordReloads)
+	siad.setPassword("new")
+	ioutil.WriteFile(file, []byte("new\n"), 0600)
+	if _, err := c.ConsensusGet(context.Background()); err != nil {
+		t.Errorf("consensus was incorrect. expected no error after the rotation got %v", err)
+	}
+	if v := testutil.ToFloat64(passwordReloads) - reloads; v != 1 {
+		t.Errorf("number of reloads was incorrect. expected %v got %v", 1, v)
+	}
+	if v := testutil.ToFloat64(authFailed); v != 0 {
+		t.Errorf("auth failed was incorrect. expected %v got %v", 0, v)
+	}
+
+	// A wrong password is flagged
+	siad.setPassword("newer")
+	if _, err := c.ConsensusGet(context.Background()); err == nil {
+		t.Errorf("consensus was incorrect. expected an error for a wrong password")
+	}
+	if v := testutil.ToFloat64(authFailed); v != 1 {
+		t.Errorf("auth failed was incorrect. expected %v got %v", 1, v)
+	}
+}
+
+func TestFindPassword(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sia_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "apipassword"), []byte("datadir\n"), 0600)
+	file := filepath.Join(dir, "password")
+	ioutil.WriteFile(file, []byte("file\n"), 0600)
+
+	t.Setenv("SIA_DATA_DIR", dir)
+	t.Setenv("SIA_API_PASSWORD", "")
+	if pw, err := findPassword(""); pw != "datadir" {
+		t.Errorf("password was incorrect. expected %v got %v (%v)", "datadir", pw, err)
+	}
+	t.Setenv("SIA_API_PASSWORD", "env")
+	if pw, err := findPassword(""); pw != "env" {
+		t.Errorf("password was incorrect. expected %v got %v (%v)", "env", pw, err)
+	}
+	if pw, err := findPassword(file); pw != "file" {
+		t.Errorf("password was incorrect. expected %v got %v (%v)", "file", pw, err)
+	}
+	if _, err := findPassword(filepath.Join(dir, "missing")); err == nil {
+		t.Errorf("findPassword was incorrect. expected an error for a missing file")
+	}
+}
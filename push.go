@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// pushgatewaySink pushes the metrics to a Prometheus Pushgateway, for nodes
+// that Prometheus cannot scrape.
+type pushgatewaySink struct {
+	url      string
+	job      string
+	grouping map[string]string
+	username string
+	password string
+	client   *http.Client
+}
+
+// newPushgatewaySink creates a pushgatewaySink pushing to the Pushgateway at
+// url, grouped by job and instance. Basic authentication is used if username
+// is set.
+func newPushgatewaySink(url, job, instance, username, password string) *pushgatewaySink {
+	return &pushgatewaySink{
+		url:      url,
+		job:      job,
+		grouping: map[string]string{"instance": instance},
+		username: username,
+		password: password,
+		client:   &http.Client{},
+	}
+}
+
+// pushClient is the HTTP client of a pushgatewaySink. Pushes the Pushgateway
+// rejected fail with a permanentError, see classifyHTTPStatus, so that they
+// are not retried.
+type pushClient struct {
+	client *http.Client
+}
+
+// Do implements push.HTTPDoer.
+func (c pushClient) Do(req *http.Request) (*http.Response, error) {
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := classifyHTTPStatus(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Name implements sink.
+func (s *pushgatewaySink) Name() string {
+	return "pushgateway"
+}
+
+// Send implements sink. The metrics replace all metrics pushed before with the
+// same grouping, so that metrics that are no longer exported disappear from
+// the Pushgateway too.
+func (s *pushgatewaySink) Send(ctx context.Context, mfs []*dto.MetricFamily) error {
+	p := push.New(s.url, s.job).
+		Gatherer(prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) { return mfs, nil })).
+		Client(pushClient{s.client})
+	for name, value := range s.grouping {
+		p = p.Grouping(name, value)
+	}
+	if s.username != "" {
+		p = p.BasicAuth(s.username, s.password)
+	}
+	return retry(ctx, func() error { return p.PushContext(ctx) })
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/sirupsen/logrus"
+)
+
+// fakePushgateway is a stand-in for a Prometheus Pushgateway that fails the
+// first pushes, with status or 503 Service Unavailable.
+type fakePushgateway struct {
+	mu       sync.Mutex
+	failures int
+	status   int
+	requests []*http.Request
+	bodies   []string
+}
+
+func (p *fakePushgateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	b, _ := ioutil.ReadAll(r.Body)
+	p.requests = append(p.requests, r)
+	p.bodies = append(p.bodies, string(b))
+	if p.failures > 0 {
+		p.failures--
+		status := p.status
+		if status == 0 {
+			status = http.StatusServiceUnavailable
+		}
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func TestPushgatewaySink(t *testing.T) {
+	log = logrus.New()
+	log.SetOutput(ioutil.Discard)
+	defer func(r int, b time.Duration, s []sink, g prometheus.Gatherer) {
+		sinkRetries, sinkBackoff, sinks, sinkGatherer = r, b, s, g
+	}(sinkRetries, sinkBackoff, sinks, sinkGatherer)
+	sinkRetries, sinkBackoff = 3, time.Millisecond
+
+	reg := prometheus.NewRegistry()
+	height := prometheus.NewGauge(prometheus.GaugeOpts{Name: "sia_consensus_height", Help: "Consensus block height"})
+	height.Set(250000)
+	reg.MustRegister(height)
+	sinkGatherer = reg
+
+	pg := &fakePushgateway{failures: 2}
+	server := httptest.NewServer(pg)
+	defer server.Close()
+	s := newPushgatewaySink(server.URL, "sia_exporter", "node1", "user", "secret")
+	sinks = []sink{s}
+
+	sendToSinks(context.Background())
+	if len(pg.requests) != 3 {
+		t.Fatalf("number of pushes was incorrect. expected %v got %v", 3, len(pg.requests))
+	}
+	r := pg.requests[2]
+	if r.Method != http.MethodPut {
+		t.Errorf("push method was incorrect. expected %v got %v", http.MethodPut, r.Method)
+	}
+	if r.URL.Path != "/metrics/job/sia_exporter/instance/node1" {
+		t.Errorf("push path was incorrect. expected %v got %v", "/metrics/job/sia_exporter/instance/node1", r.URL.Path)
+	}
+	if user, password, ok := r.BasicAuth(); !ok || user != "user" || password != "secret" {
+		t.Errorf("basic auth was incorrect. expected %v:%v got %v:%v", "user", "secret", user, password)
+	}
+	mfs := decodeMetrics(pg.bodies[2], r.Header.Get("Content-Type"))
+	if mf, ok := mfs["sia_consensus_height"]; !ok || mf.GetMetric()[0].GetGauge().GetValue() != 250000 {
+		t.Errorf("pushed metrics were incorrect. expected sia_consensus_height 250000 got %v", mfs)
+	}
+	if v := testutil.ToFloat64(sinkLastSuccess.WithLabelValues("pushgateway")); v == 0 {
+		t.Errorf("last success of the push was incorrect. expected it to be set")
+	}
+
+	// Giving up after the retries counts an error
+	pg.failures = 10
+	errs := testutil.ToFloat64(sinkErrors.WithLabelValues("pushgateway"))
+	sendToSinks(context.Background())
+	if len(pg.requests) != 7 {
+		t.Errorf("number of pushes was incorrect. expected %v got %v", 7, len(pg.requests))
+	}
+	if v := testutil.ToFloat64(sinkErrors.WithLabelValues("pushgateway")) - errs; v != 1 {
+		t.Errorf("number of push errors was incorrect. expected %v got %v", 1, v)
+	}
+
+	// Rejected pushes are not retried
+	pg.failures, pg.status = 10, http.StatusUnauthorized
+	sendToSinks(context.Background())
+	if len(pg.requests) != 8 {
+		t.Errorf("number of pushes was incorrect. expected %v got %v", 8, len(pg.requests))
+	}
+}
+
+// decodeMetrics decodes the metrics in body, encoded in contentType.
+func decodeMetrics(body, contentType string) map[string]*dto.MetricFamily {
+	dec := expfmt.NewDecoder(strings.NewReader(body), expfmt.ResponseFormat(http.Header{"Content-Type": {contentType}}))
+	mfs := make(map[string]*dto.MetricFamily)
+	for {
+		mf := &dto.MetricFamily{}
+		if err := dec.Decode(mf); err != nil {
+			return mfs
+		}
+		mfs[mf.GetName()] = mf
+	}
+}
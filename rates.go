@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// maxRateResponseSize limits how much of a rate file or HTTP response is read.
+const maxRateResponseSize = 1 << 20
+
+var (
+	// fiatCurrency is the currency siacoin metrics are mirrored in.
+	fiatCurrency string
+	// rateSource provides the siacoin exchange rate. Fiat valuation is disabled
+	// when it is nil.
+	rateSource RateSource
+
+	rateMu    sync.RWMutex
+	rate      float64
+	rateKnown bool
+
+	exchangeRate = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "sia_exchange_rate", Help: "Value of one siacoin in the fiat currency"}, []string{"currency"})
+)
+
+// RateSource provides the value of one siacoin in a fiat currency.
+type RateSource interface {
+	Rate() (float64, error)
+}
+
+// staticRate is a RateSource that always returns the same configured rate.
+type staticRate float64
+
+// Rate implements RateSource.
+func (s staticRate) Rate() (float64, error) {
+	return float64(s), nil
+}
+
+// fileRate is a RateSource that reads the rate from a local file which is kept
+// up to date by another job. The file holds either a plain number or a JSON
+// document containing the rate at path.
+type fileRate struct {
+	filename string
+	path     string
+}
+
+// Rate implements RateSource.
+func (f fileRate) Rate() (float64, error) {
+	b, err := ioutil.ReadFile(f.filename)
+	if err != nil {
+		return 0, err
+	}
+	return parseRate(b, f.path)
+}
+
+// httpRate is a RateSource that fetches the rate from an HTTP endpoint
+// returning a JSON document containing the rate at path.
+type httpRate struct {
+	url    string
+	path   string
+	client *http.Client
+}
+
+// Rate implements RateSource.
+func (h httpRate) Rate() (float64, error) {
+	resp, err := h.client.Get(h.url)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("unexpected status %v from %v", resp.Status, h.url)
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxRateResponseSize))
+	if err != nil {
+		return 0, err
+	}
+	return parseRate(b, h.path)
+}
+
+// newRateSource creates a RateSource from its flag representation, which is
+// one of "static:<rate>", "file:<filename>" or an http(s) URL. path is the
+// dotted path of the rate inside JSON documents, e.g. "siacoin.usd".
+func newRateSource(spec, path string) (RateSource, error) {
+	switch {
+	case strings.HasPrefix(spec, "static:"):
+		r, err := strconv.ParseFloat(strings.TrimPrefix(spec, "static:"), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid static exchange rate: %v", err)
+		}
+		return staticRate(r), nil
+	case strings.HasPrefix(spec, "file:"):
+		return fileRate{filename: strings.TrimPrefix(spec, "file:"), path: path}, nil
+	case strings.HasPrefix(spec, "http://"), strings.HasPrefix(spec, "https://"):
+		return httpRate{url: spec, path: path, client: &http.Client{Timeout: 30 * time.Second}}, nil
+	}
+	return nil, fmt.Errorf("unknown exchange rate source %q", spec)
+}
+
+// parseRate extracts a rate from b, which is either a plain number or a JSON
+// document holding a number (or numeric string) at the dotted path.
+func parseRate(b []byte, path string) (float64, error) {
+	if r, err := strconv.ParseFloat(strings.TrimSpace(string(b)), 64); err == nil {
+		return r, nil
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return 0, fmt.Errorf("could not decode exchange rate: %v", err)
+	}
+	if path != "" {
+		for _, key := range strings.Split(path, ".") {
+			obj, ok := v.(map[string]interface{})
+			if !ok {
+				return 0, fmt.Errorf("exchange rate path %q not found", path)
+			}
+			if v, ok = obj[key]; !ok {
+				return 0, fmt.Errorf("exchange rate path %q not found", path)
+			}
+		}
+	}
+
+	switch r := v.(type) {
+	case float64:
+		return r, nil
+	case string:
+		return strconv.ParseFloat(r, 64)
+	}
+	return 0, fmt.Errorf("exchange rate at path %q is not a number", path)
+}
+
+// updateExchangeRate fetches the current rate from the rateSource. If the
+// source fails the last known rate is kept.
+func updateExchangeRate() {
+	if rateSource == nil {
+		return
+	}
+	r, err := rateSource.Rate()
+	if err != nil {
+		log.Info("Could not get exchange rate: ", err)
+		return
+	}
+
+	rateMu.Lock()
+	rate, rateKnown = r, true
+	rateMu.Unlock()
+	exchangeRate.WithLabelValues(fiatCurrency).Set(r)
+}
+
+// currentRate returns the last known exchange rate and whether there is one.
+func currentRate() (float64, bool) {
+	rateMu.RLock()
+	defer rateMu.RUnlock()
+	return rate, rateKnown
+}
+
+// siacoinGauge is a Gauge denominated in siacoins. When an exchange rate is
+// known its value is mirrored in fiat as <name>_fiat{currency}, where <name>
+// is the name of the gauge without its _siacoins unit suffix.
+type siacoinGauge struct {
+	prometheus.Gauge
+	fiat *prometheus.GaugeVec
+}
+
+// newSiacoinGauge creates a siacoinGauge and registers it and its fiat mirror
+// with r.
+func newSiacoinGauge(r prometheus.Registerer, opts prometheus.GaugeOpts) siacoinGauge {
+	fiatOpts := opts
+	fiatOpts.Name = strings.TrimSuffix(opts.Name, "_siacoins") + "_fiat"
+	fiatOpts.Help += " (fiat)"
+	return siacoinGauge{
+		Gauge: promauto.With(r).NewGauge(opts),
+		fiat:  promauto.With(r).NewGaugeVec(fiatOpts, []string{"currency"}),
+	}
+}
+
+// Set sets the gauge to sc siacoins and updates the fiat mirror.
+func (g siacoinGauge) Set(sc float64) {
+	g.Gauge.Set(sc)
+	if r, ok := currentRate(); ok {
+		g.fiat.WithLabelValues(fiatCurrency).Set(sc * r)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+)
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		input string
+		path  string
+		rate  float64
+		err   bool
+	}{
+		{"0.0025", "", 0.0025, false},
+		{" 0.0025\n", "usd", 0.0025, false},
+		{`{"usd": 0.0025}`, "usd", 0.0025, false},
+		{`{"siacoin": {"eur": 0.002}}`, "siacoin.eur", 0.002, false},
+		{`{"siacoin": {"eur": "0.002"}}`, "siacoin.eur", 0.002, false},
+		{`{"siacoin": {"eur": 0.002}}`, "siacoin.usd", 0, true},
+		{`{"siacoin": true}`, "siacoin", 0, true},
+		{`not a rate`, "usd", 0, true},
+	}
+	for _, test := range tests {
+		rate, err := parseRate([]byte(test.input), test.path)
+		if (err != nil) != test.err {
+			t.Errorf("parseRate(%q, %q) error was incorrect. expected error %v got %v", test.input, test.path, test.err, err)
+			continue
+		}
+		if rate != test.rate {
+			t.Errorf("parseRate(%q, %q) was incorrect. expected %v got %v", test.input, test.path, test.rate, rate)
+		}
+	}
+}
+
+func TestRateSources(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sia_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	rateFile := filepath.Join(dir, "rate")
+	if err := ioutil.WriteFile(rateFile, []byte("0.003\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Local stand-in for an exchange rate API
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/price" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `{"siacoin": {"usd": 0.004}}`)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		spec string
+		rate float64
+		err  bool
+	}{
+		{"static:0.002", 0.002, false},
+		{"file:" + rateFile, 0.003, false},
+		{"file:" + filepath.Join(dir, "missing"), 0, true},
+		{server.URL + "/price", 0.004, false},
+		{server.URL + "/missing", 0, true},
+	}
+	for _, test := range tests {
+		source, err := newRateSource(test.spec, "siacoin.usd")
+		if err != nil {
+			t.Errorf("newRateSource(%q) failed: %v", test.spec, err)
+			continue
+		}
+		rate, err := source.Rate()
+		if (err != nil) != test.err {
+			t.Errorf("Rate for %q error was incorrect. expected error %v got %v", test.spec, test.err, err)
+			continue
+		}
+		if rate != test.rate {
+			t.Errorf("Rate for %q was incorrect. expected %v got %v", test.spec, test.rate, rate)
+		}
+	}
+
+	for _, spec := range []string{"static:cheap", "ftp://example.com/rate", ""} {
+		if _, err := newRateSource(spec, "usd"); err == nil {
+			t.Errorf("newRateSource(%q) was incorrect. expected an error", spec)
+		}
+	}
+}
+
+func TestSiacoinGauge(t *testing.T) {
+	log = logrus.New()
+	defer func() { rateSource, rateKnown = nil, false }()
+
+	g := siacoinGauge{
+		Gauge: prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_siacoins", Help: "test"}),
+		fiat:  prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "test_siacoins_fiat", Help: "test"}, []string{"currency"}),
+	}
+
+	// Without an exchange rate only the siacoin value is exported
+	g.Set(100)
+	if v := testutil.ToFloat64(g.Gauge); v != 100 {
+		t.Errorf("siacoinGauge was incorrect. expected %v got %v", 100, v)
+	}
+	if n := testutil.CollectAndCount(g.fiat); n != 0 {
+		t.Errorf("fiat series count was incorrect. expected %v got %v", 0, n)
+	}
+
+	fiatCurrency, rateSource = "eur", staticRate(0.5)
+	updateExchangeRate()
+	g.Set(100)
+	if v := testutil.ToFloat64(g.fiat.WithLabelValues("eur")); v != 50 {
+		t.Errorf("fiat value was incorrect. expected %v got %v", 50, v)
+	}
+	if v := testutil.ToFloat64(exchangeRate.WithLabelValues("eur")); v != 0.5 {
+		t.Errorf("sia_exchange_rate was incorrect. expected %v got %v", 0.5, v)
+	}
+}
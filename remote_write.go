@@ -0,0 +1,430 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// remoteWriteSegmentExt is the extension of the queued batches.
+const remoteWriteSegmentExt = ".snappy"
+
+var (
+	remoteWriteQueued = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "sia_exporter_remote_write_queue_batches", Help: "Number of batches waiting in the remote_write queue"})
+	remoteWriteDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sia_exporter_remote_write_dropped_batches_total", Help: "Number of batches dropped from the remote_write queue by reason (queue_full or rejected)"}, []string{"reason"})
+)
+
+// remoteWriteSink sends the metrics to a Prometheus remote_write endpoint.
+//
+// Every send is written as a batch into a queue on disk first, so that
+// batches survive the endpoint or the exporter being down. Batches are sent
+// oldest first and a batch is only removed from the queue once the endpoint
+// accepted it, or rejected it for good. When the queue exceeds maxBytes the
+// oldest batches are dropped.
+//
+// The queue is sent by a flusher in the background, so that an endpoint that
+// is slow or down does not hold up the refreshes.
+type remoteWriteSink struct {
+	url      string
+	dir      string
+	maxBytes int64
+	labels   map[string]string
+	username string
+	password string
+	client   *http.Client
+
+	mu      sync.Mutex
+	lastSeq int64
+	// lastErr is the error of the last flush.
+	lastErr error
+
+	// flushMu makes sure only one flush sends the queue at a time.
+	flushMu sync.Mutex
+	// pending wakes the flusher after a batch was queued.
+	pending chan struct{}
+	stop    context.CancelFunc
+	done    chan struct{}
+}
+
+// newRemoteWriteSink creates a remoteWriteSink sending to url and queueing in
+// dir. labels are added to every series, like the target labels Prometheus
+// adds when scraping.
+func newRemoteWriteSink(url, dir string, maxBytes int64, labels map[string]string, username, password string) (*remoteWriteSink, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	s := &remoteWriteSink{
+		url:      url,
+		dir:      dir,
+		maxBytes: maxBytes,
+		labels:   labels,
+		username: username,
+		password: password,
+		client:   &http.Client{Timeout: 30 * time.Second},
+		pending:  make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	segments, _, err := s.segments()
+	if err != nil {
+		return nil, err
+	}
+	if len(segments) > 0 {
+		log.Info("Found ", len(segments), " queued remote_write batches in ", dir)
+		s.pending <- struct{}{}
+	}
+	remoteWriteQueued.Set(float64(len(segments)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.stop = cancel
+	go s.flusher(ctx)
+	return s, nil
+}
+
+// Name implements sink.
+func (s *remoteWriteSink) Name() string {
+	return "remote_write"
+}
+
+// Send implements sink. It queues the metrics and wakes the flusher. As the
+// queue is sent in the background, it returns the error of the last flush.
+func (s *remoteWriteSink) Send(ctx context.Context, mfs []*dto.MetricFamily) error {
+	s.mu.Lock()
+	err := s.enqueue(encodeWriteRequest(mfs, s.labels, time.Now()))
+	lastErr := s.lastErr
+	s.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("could not queue batch: %v", err)
+	}
+	select {
+	case s.pending <- struct{}{}:
+	default:
+		// The flusher is already woken up
+	}
+	return lastErr
+}
+
+// Close implements io.Closer. It stops the flusher, the batches it did not
+// send stay queued for the next start.
+func (s *remoteWriteSink) Close() error {
+	s.stop()
+	<-s.done
+	return nil
+}
+
+// flusher sends the queue whenever a batch was queued, until ctx is done.
+func (s *remoteWriteSink) flusher(ctx context.Context) {
+	defer close(s.done)
+	for {
+		select {
+		case <-s.pending:
+		case <-ctx.Done():
+			return
+		}
+		err := s.flush(ctx)
+		s.mu.Lock()
+		s.lastErr = err
+		s.mu.Unlock()
+	}
+}
+
+// segments returns the queued batches, oldest first, and their total size.
+func (s *remoteWriteSink) segments() ([]string, int64, error) {
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, 0, err
+	}
+	var segments []string
+	var size int64
+	for _, f := range files {
+		if f.IsDir() || filepath.Ext(f.Name()) != remoteWriteSegmentExt {
+			continue
+		}
+		segments = append(segments, filepath.Join(s.dir, f.Name()))
+		size += f.Size()
+	}
+	sort.Strings(segments)
+	return segments, size, nil
+}
+
+// enqueue writes a batch into the queue and drops the oldest batches if the
+// queue grew too large.
+func (s *remoteWriteSink) enqueue(req []byte) error {
+	seq := time.Now().UnixNano()
+	if seq <= s.lastSeq {
+		seq = s.lastSeq + 1
+	}
+	s.lastSeq = seq
+
+	// Write to a temporary file first, so that a crash never leaves a
+	// truncated batch in the queue
+	name := filepath.Join(s.dir, fmt.Sprintf("%020d", seq))
+	if err := ioutil.WriteFile(name+".tmp", snappy.Encode(nil, req), 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(name+".tmp", name+remoteWriteSegmentExt); err != nil {
+		return err
+	}
+
+	segments, size, err := s.segments()
+	if err != nil {
+		return err
+	}
+	for len(segments) > 1 && size > s.maxBytes {
+		if fi, err := os.Stat(segments[0]); err == nil {
+			size -= fi.Size()
+		}
+		os.Remove(segments[0])
+		segments = segments[1:]
+		remoteWriteDropped.WithLabelValues("queue_full").Inc()
+		log.Warn("remote_write queue is full, dropped the oldest batch")
+	}
+	remoteWriteQueued.Set(float64(len(segments)))
+	return nil
+}
+
+// flush sends the queued batches oldest first. It stops at the first batch
+// that could not be sent, which stays queued for the next flush.
+func (s *remoteWriteSink) flush(ctx context.Context) error {
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+	segments, _, err := s.segments()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		segments, _, _ := s.segments()
+		remoteWriteQueued.Set(float64(len(segments)))
+	}()
+	for _, segment := range segments {
+		body, err := ioutil.ReadFile(segment)
+		if err != nil {
+			return err
+		}
+		err = retry(ctx, func() error { return s.post(ctx, body) })
+		if rejected, ok := err.(permanentError); ok {
+			log.Warn("remote_write endpoint rejected a batch, dropping it: ", rejected)
+			remoteWriteDropped.WithLabelValues("rejected").Inc()
+		} else if err != nil {
+			return err
+		}
+		os.Remove(segment)
+	}
+	return nil
+}
+
+// post sends a snappy compressed WriteRequest. Requests rejected with a 4xx
+// status other than 429 will never be accepted and return a permanentError.
+func (s *remoteWriteSink) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return permanentError{err}
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("User-Agent", "sia_exporter")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	if s.username != "" {
+		req.SetBasicAuth(s.username, s.password)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return classifyHTTPStatus(resp)
+}
+
+// parseLabels parses a comma separated list of name=value pairs.
+func parseLabels(s string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return nil, fmt.Errorf("invalid label %q, must be name=value", pair)
+		}
+		labels[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	return labels, nil
+}
+
+// The field numbers and metric types of the remote_write protobuf messages,
+// see prompb/types.proto and prompb/remote.proto of Prometheus.
+const (
+	writeRequestTimeseries = 1
+	writeRequestMetadata   = 3
+	timeSeriesLabels       = 1
+	timeSeriesSamples      = 2
+	labelName              = 1
+	labelValue             = 2
+	sampleValue            = 1
+	sampleTimestamp        = 2
+	metadataType           = 1
+	metadataFamilyName     = 2
+	metadataHelp           = 4
+	metadataUnit           = 5
+
+	metadataTypeUnknown = 0
+	metadataTypeCounter = 1
+	metadataTypeGauge   = 2
+	metadataTypeHist    = 3
+	metadataTypeSummary = 5
+)
+
+// encodeWriteRequest encodes the metric families as a remote_write
+// WriteRequest with all samples taken at ts and labels added to every series.
+func encodeWriteRequest(mfs []*dto.MetricFamily, labels map[string]string, ts time.Time) []byte {
+	var b []byte
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			for _, s := range flattenMetric(mf, m) {
+				all := map[string]string{}
+				for name, value := range labels {
+					all[name] = value
+				}
+				for _, lp := range m.GetLabel() {
+					all[lp.GetName()] = lp.GetValue()
+				}
+				for name, value := range s.labels {
+					all[name] = value
+				}
+				all["__name__"] = s.name
+				t := ts
+				if m.TimestampMs != nil {
+					t = time.Unix(0, m.GetTimestampMs()*int64(time.Millisecond))
+				}
+				b = protowire.AppendTag(b, writeRequestTimeseries, protowire.BytesType)
+				b = protowire.AppendBytes(b, encodeTimeSeries(all, s.value, t))
+			}
+		}
+	}
+	for _, mf := range mfs {
+		b = protowire.AppendTag(b, writeRequestMetadata, protowire.BytesType)
+		b = protowire.AppendBytes(b, encodeMetadata(mf))
+	}
+	return b
+}
+
+// encodeTimeSeries encodes a TimeSeries with a single sample.
+func encodeTimeSeries(labels map[string]string, value float64, ts time.Time) []byte {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b []byte
+	for _, name := range names {
+		var l []byte
+		l = protowire.AppendTag(l, labelName, protowire.BytesType)
+		l = protowire.AppendString(l, name)
+		l = protowire.AppendTag(l, labelValue, protowire.BytesType)
+		l = protowire.AppendString(l, labels[name])
+		b = protowire.AppendTag(b, timeSeriesLabels, protowire.BytesType)
+		b = protowire.AppendBytes(b, l)
+	}
+	var s []byte
+	s = protowire.AppendTag(s, sampleValue, protowire.Fixed64Type)
+	s = protowire.AppendFixed64(s, math.Float64bits(value))
+	s = protowire.AppendTag(s, sampleTimestamp, protowire.VarintType)
+	s = protowire.AppendVarint(s, uint64(ts.UnixNano()/int64(time.Millisecond)))
+	b = protowire.AppendTag(b, timeSeriesSamples, protowire.BytesType)
+	return protowire.AppendBytes(b, s)
+}
+
+// encodeMetadata encodes the MetricMetadata of a metric family.
+func encodeMetadata(mf *dto.MetricFamily) []byte {
+	typ := metadataTypeUnknown
+	switch mf.GetType() {
+	case dto.MetricType_COUNTER:
+		typ = metadataTypeCounter
+	case dto.MetricType_GAUGE:
+		typ = metadataTypeGauge
+	case dto.MetricType_HISTOGRAM:
+		typ = metadataTypeHist
+	case dto.MetricType_SUMMARY:
+		typ = metadataTypeSummary
+	}
+	var b []byte
+	b = protowire.AppendTag(b, metadataType, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(typ))
+	b = protowire.AppendTag(b, metadataFamilyName, protowire.BytesType)
+	b = protowire.AppendString(b, mf.GetName())
+	b = protowire.AppendTag(b, metadataHelp, protowire.BytesType)
+	b = protowire.AppendString(b, mf.GetHelp())
+	if unit := metricUnit(mf); unit != "" {
+		b = protowire.AppendTag(b, metadataUnit, protowire.BytesType)
+		b = protowire.AppendString(b, unit)
+	}
+	return b
+}
+
+// flatSample is a single sample of a metric, as exposed in the text format.
+type flatSample struct {
+	name   string
+	labels map[string]string
+	value  float64
+}
+
+// flattenMetric returns the samples of a metric as they appear in the text
+// format, e.g. the _bucket, _sum and _count samples of a histogram.
+func flattenMetric(mf *dto.MetricFamily, m *dto.Metric) []flatSample {
+	name := mf.GetName()
+	switch mf.GetType() {
+	case dto.MetricType_COUNTER:
+		return []flatSample{{name: name, value: m.GetCounter().GetValue()}}
+	case dto.MetricType_GAUGE:
+		return []flatSample{{name: name, value: m.GetGauge().GetValue()}}
+	case dto.MetricType_SUMMARY:
+		s := m.GetSummary()
+		samples := []flatSample{
+			{name: name + "_sum", value: s.GetSampleSum()},
+			{name: name + "_count", value: float64(s.GetSampleCount())},
+		}
+		for _, q := range s.GetQuantile() {
+			samples = append(samples, flatSample{name: name, labels: map[string]string{"quantile": formatFloat(q.GetQuantile())}, value: q.GetValue()})
+		}
+		return samples
+	case dto.MetricType_HISTOGRAM:
+		h := m.GetHistogram()
+		samples := []flatSample{
+			{name: name + "_sum", value: h.GetSampleSum()},
+			{name: name + "_count", value: float64(h.GetSampleCount())},
+			{name: name + "_bucket", labels: map[string]string{"le": "+Inf"}, value: float64(h.GetSampleCount())},
+		}
+		for _, bucket := range h.GetBucket() {
+			if math.IsInf(bucket.GetUpperBound(), 1) {
+				continue
+			}
+			samples = append(samples, flatSample{name: name + "_bucket", labels: map[string]string{"le": formatFloat(bucket.GetUpperBound())}, value: float64(bucket.GetCumulativeCount())})
+		}
+		return samples
+	}
+	return []flatSample{{name: name, value: m.GetUntyped().GetValue()}}
+}
+
+// formatFloat formats a float like Prometheus formats label values.
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// writtenSample is a sample decoded from a remote_write WriteRequest.
+type writtenSample struct {
+	labels map[string]string
+	value  float64
+	ts     int64
+}
+
+// fakeRemoteWrite is a stand-in for a remote_write receiver answering with
+// status until it is changed.
+type fakeRemoteWrite struct {
+	mu      sync.Mutex
+	status  int
+	batches [][]writtenSample
+}
+
+func (f *fakeRemoteWrite) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.status != http.StatusOK {
+		w.WriteHeader(f.status)
+		return
+	}
+	if r.Header.Get("Content-Encoding") != "snappy" || r.Header.Get("X-Prometheus-Remote-Write-Version") != "0.1.0" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	b, _ := ioutil.ReadAll(r.Body)
+	req, err := snappy.Decode(nil, b)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	f.batches = append(f.batches, decodeWriteRequest(req))
+}
+
+// decodeWriteRequest decodes the samples of a WriteRequest.
+func decodeWriteRequest(b []byte) []writtenSample {
+	var samples []writtenSample
+	forEachField(b, func(num protowire.Number, v []byte, _ uint64) {
+		if num != writeRequestTimeseries {
+			return
+		}
+		s := writtenSample{labels: map[string]string{}}
+		forEachField(v, func(num protowire.Number, v []byte, _ uint64) {
+			switch num {
+			case timeSeriesLabels:
+				var name, value string
+				forEachField(v, func(num protowire.Number, v []byte, _ uint64) {
+					if num == labelName {
+						name = string(v)
+					} else if num == labelValue {
+						value = string(v)
+					}
+				})
+				s.labels[name] = value
+			case timeSeriesSamples:
+				forEachField(v, func(num protowire.Number, _ []byte, n uint64) {
+					if num == sampleValue {
+						s.value = math.Float64frombits(n)
+					} else if num == sampleTimestamp {
+						s.ts = int64(n)
+					}
+				})
+			}
+		})
+		samples = append(samples, s)
+	})
+	return samples
+}
+
+// forEachField calls f with every field of a protobuf message, passing bytes
+// fields as v and numeric fields as n.
+func forEachField(b []byte, f func(num protowire.Number, v []byte, n uint64)) {
+	for len(b) > 0 {
+		num, typ, l := protowire.ConsumeTag(b)
+		if l < 0 {
+			return
+		}
+		b = b[l:]
+		switch typ {
+		case protowire.BytesType:
+			v, l := protowire.ConsumeBytes(b)
+			f(num, v, 0)
+			b = b[l:]
+		case protowire.VarintType:
+			n, l := protowire.ConsumeVarint(b)
+			f(num, nil, n)
+			b = b[l:]
+		case protowire.Fixed64Type:
+			n, l := protowire.ConsumeFixed64(b)
+			f(num, nil, n)
+			b = b[l:]
+		default:
+			return
+		}
+	}
+}
+
+func TestEncodeWriteRequest(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	errs := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test_errors_total", Help: "test"}, []string{"kind"})
+	errs.WithLabelValues("auth").Add(2)
+	h := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "test_seconds", Help: "test", Buckets: []float64{1}})
+	h.Observe(0.5)
+	reg.MustRegister(errs, h)
+	mfs, _ := reg.Gather()
+
+	ts := time.Unix(1600000000, 0)
+	samples := decodeWriteRequest(encodeWriteRequest(mfs, map[string]string{"job": "sia_exporter", "kind": "overridden"}, ts))
+	expected := map[string]float64{
+		// Labels of the metric take precedence over the added labels
+		"test_errors_total{auth}":             2,
+		"test_seconds_bucket{overridden1}":    1,
+		"test_seconds_bucket{overridden+Inf}": 1,
+		"test_seconds_sum{overridden}":        0.5,
+		"test_seconds_count{overridden}":      1,
+	}
+	if len(samples) != len(expected) {
+		t.Fatalf("number of samples was incorrect. expected %v got %v", len(expected), len(samples))
+	}
+	for _, s := range samples {
+		key := s.labels["__name__"] + "{" + s.labels["kind"] + s.labels["le"] + "}"
+		if v, ok := expected[key]; !ok || v != s.value {
+			t.Errorf("sample %v was incorrect. expected %v got %v", key, v, s.value)
+		}
+		if s.labels["job"] != "sia_exporter" || s.ts != 1600000000000 {
+			t.Errorf("sample %v was incorrect. expected job %v at %v got %v at %v", key, "sia_exporter", 1600000000000, s.labels["job"], s.ts)
+		}
+	}
+}
+
+func TestRemoteWriteSink(t *testing.T) {
+	log = logrus.New()
+	log.SetOutput(ioutil.Discard)
+	defer func(r int, b time.Duration) { sinkRetries, sinkBackoff = r, b }(sinkRetries, sinkBackoff)
+	sinkRetries, sinkBackoff = 1, time.Millisecond
+
+	dir, err := ioutil.TempDir("", "sia_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	receiver := &fakeRemoteWrite{status: http.StatusServiceUnavailable}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+	s, err := newRemoteWriteSink(server.URL, dir, 1<<20, map[string]string{"instance": "node1"}, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	// send queues the metrics and waits for the queue to be flushed
+	send := func(mfs []*dto.MetricFamily) error {
+		s.Send(context.Background(), mfs)
+		return s.flush(context.Background())
+	}
+	height := func(h float64) []*dto.MetricFamily {
+		return []*dto.MetricFamily{{
+			Name:   stringPtr("sia_consensus_height"),
+			Help:   stringPtr("Consensus block height"),
+			Type:   dto.MetricType_GAUGE.Enum(),
+			Metric: []*dto.Metric{{Gauge: &dto.Gauge{Value: &h}}},
+		}}
+	}
+
+	// Batches are kept while the receiver is down
+	for i := 1; i <= 2; i++ {
+		if err := send(height(float64(i))); err == nil {
+			t.Errorf("send was incorrect. expected an error")
+		}
+	}
+	if v := testutil.ToFloat64(remoteWriteQueued); v != 2 {
+		t.Errorf("number of queued batches was incorrect. expected %v got %v", 2, v)
+	}
+
+	// and sent oldest first once it is back
+	receiver.mu.Lock()
+	receiver.status = http.StatusOK
+	receiver.mu.Unlock()
+	if err := send(height(3)); err != nil {
+		t.Fatal(err)
+	}
+	if len(receiver.batches) != 3 {
+		t.Fatalf("number of batches was incorrect. expected %v got %v", 3, len(receiver.batches))
+	}
+	for i, batch := range receiver.batches {
+		if len(batch) != 1 || batch[0].value != float64(i+1) || batch[0].labels["instance"] != "node1" {
+			t.Errorf("batch %v was incorrect. expected sia_consensus_height %v got %v", i, i+1, batch)
+		}
+	}
+	if v := testutil.ToFloat64(remoteWriteQueued); v != 0 {
+		t.Errorf("number of queued batches was incorrect. expected %v got %v", 0, v)
+	}
+
+	// Rejected batches are dropped
+	receiver.mu.Lock()
+	receiver.status = http.StatusBadRequest
+	receiver.mu.Unlock()
+	rejected := testutil.ToFloat64(remoteWriteDropped.WithLabelValues("rejected"))
+	if err := send(height(4)); err != nil {
+		t.Errorf("send was incorrect. expected no error got %v", err)
+	}
+	if v := testutil.ToFloat64(remoteWriteDropped.WithLabelValues("rejected")) - rejected; v != 1 {
+		t.Errorf("number of rejected batches was incorrect. expected %v got %v", 1, v)
+	}
+
+	// A full queue drops the oldest batches
+	receiver.mu.Lock()
+	receiver.status = http.StatusServiceUnavailable
+	receiver.mu.Unlock()
+	s.maxBytes = 1
+	full := testutil.ToFloat64(remoteWriteDropped.WithLabelValues("queue_full"))
+	for i := 0; i < 3; i++ {
+		send(height(5))
+	}
+	if v := testutil.ToFloat64(remoteWriteDropped.WithLabelValues("queue_full")) - full; v != 2 {
+		t.Errorf("number of dropped batches was incorrect. expected %v got %v", 2, v)
+	}
+	if v := testutil.ToFloat64(remoteWriteQueued); v != 1 {
+		t.Errorf("number of queued batches was incorrect. expected %v got %v", 1, v)
+	}
+}
+
+func TestRemoteWriteSendDoesNotWait(t *testing.T) {
+	log = logrus.New()
+	log.SetOutput(ioutil.Discard)
+	dir, err := ioutil.TempDir("", "sia_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+	s, err := newRemoteWriteSink(server.URL, dir, 1<<20, nil, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	done := make(chan error)
+	go func() {
+		for i := 0; i < 3; i++ {
+			s.Send(context.Background(), nil)
+		}
+		done <- nil
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("send was incorrect. expected it not to wait for the endpoint")
+	}
+}
+
+func TestParseLabels(t *testing.T) {
+	labels, err := parseLabels("job=sia_exporter, instance = node1,")
+	if err != nil || len(labels) != 2 || labels["job"] != "sia_exporter" || labels["instance"] != "node1" {
+		t.Errorf("parseLabels was incorrect. expected job and instance got %v (%v)", labels, err)
+	}
+	if _, err := parseLabels("job"); err == nil {
+		t.Errorf("parseLabels was incorrect. expected an error")
+	}
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// refreshInterval is a flag.Value of the -refresh interval. It takes a
+// duration such as 15s, or a bare number of minutes, which was the only
+// format before durations.
+type refreshInterval time.Duration
+
+// String implements flag.Value.
+func (r *refreshInterval) String() string {
+	return time.Duration(*r).String()
+}
+
+// Set implements flag.Value.
+func (r *refreshInterval) Set(s string) error {
+	d, err := parseRefreshInterval(s)
+	if err != nil {
+		return err
+	}
+	*r = refreshInterval(d)
+	return nil
+}
+
+// parseRefreshInterval parses a duration or a bare number of minutes.
+func parseRefreshInterval(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	d, err := time.ParseDuration(s)
+	if minutes, errMinutes := strconv.Atoi(s); errMinutes == nil {
+		d, err = time.Duration(minutes)*time.Minute, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("invalid refresh interval %q, must be a duration like 15s or a number of minutes", s)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("invalid refresh interval %q, must be positive", s)
+	}
+	return d, nil
+}
+
+// parseModuleIntervals parses a comma separated list of module=interval
+// pairs.
+func parseModuleIntervals(s string) (map[string]time.Duration, error) {
+	intervals := make(map[string]time.Duration)
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid module refresh interval %q, must be module=interval", pair)
+		}
+		name := strings.TrimSpace(kv[0])
+		if !containsCollector(moduleCollectors, name) {
+			return nil, fmt.Errorf("unknown module %q in refresh intervals", name)
+		}
+		d, err := parseRefreshInterval(kv[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid refresh interval for %v: %v", name, err)
+		}
+		intervals[name] = d
+	}
+	return intervals, nil
+}
+
+// schedule keeps track of when the collectors are due for a refresh. Every
+// collector is refreshed at its interval, and at twice the interval after
+// every further consecutive failure, up to maxBackoff, so that a module that
+// keeps failing is not hammered.
+type schedule struct {
+	collectors []moduleCollector
+	interval   time.Duration
+	intervals  map[string]time.Duration
+	maxBackoff time.Duration
+
+	failures map[string]int
+	due      map[string]time.Time
+}
+
+// newSchedule creates a schedule refreshing the collectors every interval, or
+// at the module's interval in intervals, starting at start.
+func newSchedule(collectors []moduleCollector, interval time.Duration, intervals map[string]time.Duration, maxBackoff time.Duration, start time.Time) *schedule {
+	s := &schedule{
+		collectors: collectors,
+		interval:   interval,
+		intervals:  intervals,
+		maxBackoff: maxBackoff,
+		failures:   make(map[string]int),
+		due:        make(map[string]time.Time),
+	}
+	for _, c := range collectors {
+		s.due[c.name] = start.Add(s.baseInterval(c.name))
+	}
+	return s
+}
+
+// baseInterval returns the refresh interval of a module without backoff.
+func (s *schedule) baseInterval(name string) time.Duration {
+	if d, ok := s.intervals[name]; ok {
+		return d
+	}
+	return s.interval
+}
+
+// delay returns the time until the next refresh of a module.
+func (s *schedule) delay(name string) time.Duration {
+	d := s.baseInterval(name)
+	max := s.maxBackoff
+	if max < d {
+		max = d
+	}
+	for i := 0; i < s.failures[name] && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
+
+// next returns when the next collector is due.
+func (s *schedule) next() time.Time {
+	var next time.Time
+	for _, due := range s.due {
+		if next.IsZero() || due.Before(next) {
+			next = due
+		}
+	}
+	return next
+}
+
+// dueCollectors returns the collectors that are due at now, and the shortest
+// of their intervals, which is how long their refresh may take.
+func (s *schedule) dueCollectors(now time.Time) ([]moduleCollector, time.Duration) {
+	var due []moduleCollector
+	var timeout time.Duration
+	for _, c := range s.collectors {
+		if s.due[c.name].After(now) {
+			continue
+		}
+		due = append(due, c)
+		if d := s.baseInterval(c.name); timeout == 0 || d < timeout {
+			timeout = d
+		}
+	}
+	return due, timeout
+}
+
+// done records the outcome of a refresh of a module at now and schedules its
+// next refresh.
+func (s *schedule) done(name string, err error, now time.Time) {
+	if err != nil {
+		s.failures[name]++
+	} else {
+		s.failures[name] = 0
+	}
+	s.due[name] = now.Add(s.delay(name))
+	if err != nil {
+		log.Debug("Refreshing ", name, " again in ", s.delay(name), " after ", s.failures[name], " failures")
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"gitlab.com/NebulousLabs/errors"
+)
+
+func TestParseRefreshInterval(t *testing.T) {
+	tests := []struct {
+		s        string
+		expected time.Duration
+	}{
+		{"5", 5 * time.Minute},
+		{"15s", 15 * time.Second},
+		{"1h30m", 90 * time.Minute},
+	}
+	for _, test := range tests {
+		if d, err := parseRefreshInterval(test.s); err != nil || d != test.expected {
+			t.Errorf("interval of %v was incorrect. expected %v got %v (%v)", test.s, test.expected, d, err)
+		}
+	}
+	for _, s := range []string{"", "0", "-5s", "fast"} {
+		if _, err := parseRefreshInterval(s); err == nil {
+			t.Errorf("parseRefreshInterval was incorrect. expected an error for %q", s)
+		}
+	}
+}
+
+func TestParseModuleIntervals(t *testing.T) {
+	intervals, err := parseModuleIntervals("hostdb=1h, consensus=15s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(intervals) != 2 || intervals["hostdb"] != time.Hour || intervals["consensus"] != 15*time.Second {
+		t.Errorf("intervals were incorrect. expected hostdb=1h and consensus=15s got %v", intervals)
+	}
+	for _, s := range []string{"miner=1m", "hostdb", "hostdb=never"} {
+		if _, err := parseModuleIntervals(s); err == nil {
+			t.Errorf("parseModuleIntervals was incorrect. expected an error for %q", s)
+		}
+	}
+}
+
+func TestSchedule(t *testing.T) {
+	collectors := []moduleCollector{{name: "consensus"}, {name: "hostdb"}}
+	start := time.Unix(0, 0)
+	s := newSchedule(collectors, time.Minute, map[string]time.Duration{"hostdb": time.Hour}, 4*time.Minute, start)
+
+	if next := s.next(); !next.Equal(start.Add(time.Minute)) {
+		t.Errorf("next refresh was incorrect. expected %v got %v", start.Add(time.Minute), next)
+	}
+	due, timeout := s.dueCollectors(start.Add(time.Minute))
+	if len(due) != 1 || due[0].name != "consensus" || timeout != time.Minute {
+		t.Errorf("due collectors were incorrect. expected consensus within 1m got %v within %v", due, timeout)
+	}
+	due, timeout = s.dueCollectors(start.Add(time.Hour))
+	if len(due) != 2 || timeout != time.Minute {
+		t.Errorf("due collectors were incorrect. expected both within 1m got %v within %v", due, timeout)
+	}
+
+	// A failing module backs off up to the maximum
+	for _, expected := range []time.Duration{2 * time.Minute, 4 * time.Minute, 4 * time.Minute} {
+		s.done("consensus", errors.New("siad is down"), start)
+		if d := s.delay("consensus"); d != expected {
+			t.Errorf("backoff was incorrect. expected %v got %v", expected, d)
+		}
+	}
+	if due := s.due["consensus"]; !due.Equal(start.Add(4 * time.Minute)) {
+		t.Errorf("next refresh was incorrect. expected %v got %v", start.Add(4*time.Minute), due)
+	}
+	s.done("consensus", nil, start)
+	if d := s.delay("consensus"); d != time.Minute {
+		t.Errorf("delay after a success was incorrect. expected %v got %v", time.Minute, d)
+	}
+
+	// The maximum backoff does not shorten longer intervals
+	s.done("hostdb", errors.New("siad is down"), start)
+	if d := s.delay("hostdb"); d != time.Hour {
+		t.Errorf("backoff was incorrect. expected %v got %v", time.Hour, d)
+	}
+}
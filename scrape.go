@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/node/api"
+	"gitlab.com/NebulousLabs/errors"
+	"golang.org/x/sync/singleflight"
+)
+
+var (
+	// Exporter self-metrics, so that the exporter itself can be alerted on
+	scrapeDuration = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "sia_exporter_scrape_duration_seconds", Help: "Duration of the last metrics collection of a module"}, []string{"module"})
+	scrapeSuccess = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "sia_exporter_scrape_success", Help: "Did the last metrics collection of a module succeed. 0=failed.  1=succeeded"}, []string{"module"})
+	lastSuccess = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "sia_exporter_last_success_timestamp_seconds", Help: "Unix time of the last successful metrics collection of a module"}, []string{"module"})
+	apiCalls = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sia_exporter_api_calls_total", Help: "Number of Sia API calls by module and endpoint"}, []string{"module", "endpoint"})
+	apiErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sia_exporter_api_errors_total", Help: "Number of failed Sia API calls by module, endpoint and kind of error"}, []string{"module", "endpoint", "kind"})
+)
+
+// collections deduplicates concurrent collections of the same module, so that
+// a module that is still being collected is not collected again.
+var collections singleflight.Group
+
+// collectModule runs the metrics collection function of a module and records
+// how long it took and whether it succeeded. The outcome also decides whether
+// the module's metrics are exported, see moduleMetrics.
+//
+// If ctx is done before the collection finishes it is recorded as failed, its
+// Sia API calls are abandoned and its late outcome is ignored. Collections of
+// a module that start while it is still being collected wait for that
+// collection instead.
+func collectModule(ctx context.Context, name string, collect func(context.Context, apiClient) error, sc apiClient) error {
+	start := time.Now()
+	if err := ctx.Err(); err != nil {
+		err = fmt.Errorf("collection of %v metrics not started: %v", name, err)
+		return recordCollection(name, 0, err)
+	}
+
+	done := collections.DoChan(name, func() (interface{}, error) {
+		return nil, collect(ctx, sc)
+	})
+	select {
+	case res := <-done:
+		return recordCollection(name, time.Since(start), res.Err)
+	case <-ctx.Done():
+		err := fmt.Errorf("collection of %v metrics did not finish in time: %v", name, ctx.Err())
+		return recordCollection(name, time.Since(start), err)
+	}
+}
+
+// recordCollection records the duration and outcome of the collection of a
+// module and returns its error. A module siad did not load is not a failure,
+// but its metrics are withheld.
+func recordCollection(name string, duration time.Duration, err error) error {
+	notLoaded := errors.Contains(err, errModuleNotLoaded)
+	if notLoaded {
+		err = nil
+	}
+	scrapeDuration.WithLabelValues(name).Set(duration.Seconds())
+	recordStatus(name, duration, err)
+	if g, ok := moduleGroups[name]; ok {
+		if notLoaded {
+			g.reset()
+		} else {
+			g.setResult(err)
+		}
+	}
+	if err != nil {
+		log.Debug("Collection of ", name, " metrics failed: ", err)
+		scrapeSuccess.WithLabelValues(name).Set(0)
+		return err
+	}
+	scrapeSuccess.WithLabelValues(name).Set(1)
+	lastSuccess.WithLabelValues(name).SetToCurrentTime()
+	return nil
+}
+
+// endpointModules holds the module an endpoint's API calls are recorded
+// under.
+var endpointModules = map[string]string{
+	"/consensus":        "consensus",
+	"/daemon/settings":  "daemon",
+	"/gateway":          "gateway",
+	"/host":             "host",
+	"/host/storage":     "host",
+	"/hostdb/all":       "hostdb",
+	"/renter":           "renter",
+	"/renter/contracts": "renter",
+	"/renter/dir":       "renter",
+	"/wallet":           "wallet",
+	"/wallet/addresses": "wallet",
+}
+
+// recordingClient is an apiClient recording the calls made to another
+// apiClient, see recordAPICall. It sits below the cachedClient, so that only
+// the calls that reach siad are recorded.
+type recordingClient struct {
+	client apiClient
+	// target is the address of the siad called, added to the log entries.
+	target string
+}
+
+// record records a call to endpoint and returns its error.
+func (c recordingClient) record(endpoint string, err error) error {
+	recordAPICall(endpointModules[endpoint], endpoint, c.target, err)
+	return err
+}
+
+// ConsensusGet implements apiClient.
+func (c recordingClient) ConsensusGet(ctx context.Context) (api.ConsensusGET, error) {
+	cg, err := c.client.ConsensusGet(ctx)
+	return cg, c.record("/consensus", err)
+}
+
+// DaemonSettingsGet implements apiClient.
+func (c recordingClient) DaemonSettingsGet(ctx context.Context) (api.DaemonSettingsGet, error) {
+	dsg, err := c.client.DaemonSettingsGet(ctx)
+	return dsg, c.record("/daemon/settings", err)
+}
+
+// GatewayGet implements apiClient.
+func (c recordingClient) GatewayGet(ctx context.Context) (api.GatewayGET, error) {
+	gg, err := c.client.GatewayGet(ctx)
+	return gg, c.record("/gateway", err)
+}
+
+// HostGet implements apiClient.
+func (c recordingClient) HostGet(ctx context.Context) (api.HostGET, error) {
+	hg, err := c.client.HostGet(ctx)
+	return hg, c.record("/host", err)
+}
+
+// HostStorageGet implements apiClient.
+func (c recordingClient) HostStorageGet(ctx context.Context) (api.StorageGET, error) {
+	sg, err := c.client.HostStorageGet(ctx)
+	return sg, c.record("/host/storage", err)
+}
+
+// HostDbAllGet implements apiClient.
+func (c recordingClient) HostDbAllGet(ctx context.Context) (api.HostdbAllGET, error) {
+	hdg, err := c.client.HostDbAllGet(ctx)
+	return hdg, c.record("/hostdb/all", err)
+}
+
+// RenterGet implements apiClient.
+func (c recordingClient) RenterGet(ctx context.Context) (api.RenterGET, error) {
+	rg, err := c.client.RenterGet(ctx)
+	return rg, c.record("/renter", err)
+}
+
+// RenterDisabledContractsGet implements apiClient.
+func (c recordingClient) RenterDisabledContractsGet(ctx context.Context) (api.RenterContracts, error) {
+	rc, err := c.client.RenterDisabledContractsGet(ctx)
+	return rc, c.record("/renter/contracts", err)
+}
+
+// RenterDirGet implements apiClient.
+func (c recordingClient) RenterDirGet(ctx context.Context, siaPath modules.SiaPath) (api.RenterDirectory, error) {
+	rd, err := c.client.RenterDirGet(ctx, siaPath)
+	return rd, c.record("/renter/dir", err)
+}
+
+// WalletGet implements apiClient.
+func (c recordingClient) WalletGet(ctx context.Context) (api.WalletGET, error) {
+	wg, err := c.client.WalletGet(ctx)
+	return wg, c.record("/wallet", err)
+}
+
+// WalletAddressesGet implements apiClient.
+func (c recordingClient) WalletAddressesGet(ctx context.Context) (api.WalletAddressesGET, error) {
+	wag, err := c.client.WalletAddressesGet(ctx)
+	return wag, c.record("/wallet/addresses", err)
+}
+
+// newCallID returns a random ID identifying a Sia API call in exemplars and
+// logs.
+func newCallID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// recordAPICall counts a call to a Sia API endpoint and, if err is not nil,
+// the failure. Both counters get the ID of the call as exemplar, which is also
+// logged, so that a spike of errors in Grafana leads to the log lines of the
+// calls. Failures are logged with the module, endpoint and target siad
+// address, once per interval of repeats while they keep failing.
+func recordAPICall(module, endpoint, target string, err error) {
+	id := newCallID()
+	exemplar := prometheus.Labels{"call_id": id}
+	apiCalls.WithLabelValues(module, endpoint).(prometheus.ExemplarAdder).AddWithExemplar(1, exemplar)
+	entry := log.WithFields(logrus.Fields{"module": module, "endpoint": endpoint, "target": target, "call_id": id})
+	key := module + " " + endpoint
+	if err == nil {
+		entry.Debug("Sia API call succeeded")
+		repeats.resolve(key, entry, "Sia API call succeeded again")
+		return
+	}
+	kind := errorKind(err)
+	apiErrors.WithLabelValues(module, endpoint, kind).(prometheus.ExemplarAdder).AddWithExemplar(1, exemplar)
+	entry = entry.WithField("kind", kind).WithError(err)
+	if kind == "not_recognized" {
+		repeats.log(key, entry, logrus.InfoLevel, "Module is not loaded")
+		return
+	}
+	repeats.log(key, entry, logrus.WarnLevel, "Sia API call failed")
+}
+
+// errorKind classifies an error returned by the Sia API client. Errors
+// returned by the client carry no type information, so they are classified by
+// their message.
+func errorKind(err error) string {
+	if errors.Contains(err, ErrAPICallNotRecognized) {
+		return "not_recognized"
+	}
+	msg := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(msg, "authentication"), strings.Contains(msg, "unauthorized"):
+		return "auth"
+	case strings.Contains(msg, "timeout"), strings.Contains(msg, "deadline exceeded"):
+		return "timeout"
+	case strings.Contains(msg, "connection refused"), strings.Contains(msg, "no such host"),
+		strings.Contains(msg, "connection reset"), strings.Contains(msg, "eof"):
+		return "connection"
+	case strings.Contains(msg, "json"), strings.Contains(msg, "decode"), strings.Contains(msg, "invalid character"):
+		return "decode"
+	}
+	return "api"
+}
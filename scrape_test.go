@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+	"gitlab.com/NebulousLabs/errors"
+)
+
+func TestErrorKind(t *testing.T) {
+	tests := []struct {
+		err  error
+		kind string
+	}{
+		{ErrAPICallNotRecognized, "not_recognized"},
+		{errors.New("API authentication failed."), "auth"},
+		{errors.New("Get http://127.0.0.1:9980/consensus: dial tcp 127.0.0.1:9980: connect: connection refused"), "connection"},
+		{errors.New("net/http: request canceled (Client.Timeout exceeded while awaiting headers)"), "timeout"},
+		{errors.New("could not read response: unexpected EOF"), "connection"},
+		{errors.New("invalid character '<' looking for beginning of value"), "decode"},
+		{errors.New("json: cannot unmarshal string into Go value"), "decode"},
+		{errors.New("wallet must be unlocked before it can be used"), "api"},
+	}
+	for _, test := range tests {
+		if kind := errorKind(test.err); kind != test.kind {
+			t.Errorf("errorKind(%q) was incorrect. expected %v got %v", test.err, test.kind, kind)
+		}
+	}
+}
+
+func TestCollectModule(t *testing.T) {
+	log = logrus.New()
+
+	collectModule(context.Background(), "test_ok", func(context.Context, apiClient) error { return nil }, nil)
+	if v := testutil.ToFloat64(scrapeSuccess.WithLabelValues("test_ok")); v != 1 {
+		t.Errorf("scrape success was incorrect. expected %v got %v", 1, v)
+	}
+	if v := testutil.ToFloat64(lastSuccess.WithLabelValues("test_ok")); v == 0 {
+		t.Errorf("last success timestamp was incorrect. expected it to be set")
+	}
+
+	collectModule(context.Background(), "test_fail", func(context.Context, apiClient) error {
+		err := errors.New("API authentication failed.")
+		recordAPICall("test_fail", "/consensus", "", err)
+		return err
+	}, nil)
+	if v := testutil.ToFloat64(scrapeSuccess.WithLabelValues("test_fail")); v != 0 {
+		t.Errorf("scrape success was incorrect. expected %v got %v", 0, v)
+	}
+	if v := testutil.ToFloat64(lastSuccess.WithLabelValues("test_fail")); v != 0 {
+		t.Errorf("last success timestamp was incorrect. expected %v got %v", 0, v)
+	}
+	if v := testutil.ToFloat64(apiErrors.WithLabelValues("test_fail", "/consensus", "auth")); v != 1 {
+		t.Errorf("api errors was incorrect. expected %v got %v", 1, v)
+	}
+
+	// A nil error is not counted
+	recordAPICall("test_fail", "/consensus", "", nil)
+	if v := testutil.ToFloat64(apiErrors.WithLabelValues("test_fail", "/consensus", "auth")); v != 1 {
+		t.Errorf("api errors was incorrect. expected %v got %v", 1, v)
+	}
+
+	// The late outcome of a collection that did not finish in time is ignored
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	release, returned := make(chan struct{}), make(chan struct{})
+	err := collectModule(ctx, "test_late", func(context.Context, apiClient) error {
+		defer close(returned)
+		<-release
+		return nil
+	}, nil)
+	if err == nil {
+		t.Fatalf("collection was incorrect. expected a timeout")
+	}
+	close(release)
+	<-returned
+	time.Sleep(10 * time.Millisecond)
+	if v := testutil.ToFloat64(scrapeSuccess.WithLabelValues("test_late")); v != 0 {
+		t.Errorf("scrape success was incorrect. expected the timeout %v got %v", 0, v)
+	}
+}
+
+func TestAbandonedCollection(t *testing.T) {
+	log = logrus.New()
+	log.SetOutput(ioutil.Discard)
+	defer resetAllModuleMetrics()
+
+	// siad hangs on the first call to /hostdb/all
+	var requests int32
+	siad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			<-r.Context().Done()
+			return
+		}
+		fmt.Fprint(w, `{"hosts": []}`)
+	}))
+	defer siad.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := collectModule(ctx, "hostdb", hostdbMetrics, fakeClient(siad.URL)); err == nil {
+		t.Fatalf("collection was incorrect. expected a timeout")
+	}
+
+	// The hanging call was abandoned, so the next collection calls siad again
+	time.Sleep(10 * time.Millisecond)
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := collectModule(ctx, "hostdb", hostdbMetrics, fakeClient(siad.URL)); err != nil {
+		t.Errorf("collection was incorrect. expected no error got %v", err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Errorf("number of requests was incorrect. expected %v got %v", 2, n)
+	}
+}
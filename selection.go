@@ -0,0 +1,222 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// moduleFlags are the letters -modules accepts. The miner (m) and
+// transactionpool (t) have no collectors yet.
+const moduleFlags = "cghmrtw"
+
+// collectorOverrides holds whether a collector was enabled or disabled by
+// name with -collector.<name> or -no-collector.<name>, by collector name.
+var collectorOverrides = map[string]bool{}
+
+// collectorFlag is a boolean flag.Value enabling, or disabling if enable is
+// false, a collector by name.
+type collectorFlag struct {
+	name   string
+	enable bool
+}
+
+// IsBoolFlag allows the flag without a value, as in -collector.hostdb.
+func (f collectorFlag) IsBoolFlag() bool {
+	return true
+}
+
+// String implements flag.Value.
+func (f collectorFlag) String() string {
+	return ""
+}
+
+// Set implements flag.Value.
+func (f collectorFlag) Set(s string) error {
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	collectorOverrides[f.name] = b == f.enable
+	return nil
+}
+
+// registerCollectorFlags registers -collector.<name> and -no-collector.<name>
+// for every collector.
+func registerCollectorFlags(fs *flag.FlagSet) {
+	for _, c := range moduleCollectors {
+		byDefault := " (default is set by -modules)"
+		if c.flag == "" {
+			byDefault = " (enabled by default)"
+		}
+		fs.Var(collectorFlag{name: c.name, enable: true}, "collector."+c.name, "Enable the "+c.name+" collector: "+c.help+byDefault)
+		fs.Var(collectorFlag{name: c.name, enable: false}, "no-collector."+c.name, "Disable the "+c.name+" collector")
+	}
+}
+
+// validateModules returns an error if modules contains letters that are not
+// Sia modules.
+func validateModules(modules string) error {
+	for _, m := range modules {
+		if !strings.ContainsRune(moduleFlags, m) {
+			return fmt.Errorf("unknown module %q in -modules, must be one of %q", m, moduleFlags)
+		}
+	}
+	return nil
+}
+
+// requestedCollectors returns the enabled collectors selected by the
+// collect[] query parameters of r, or all enabled collectors without them.
+func requestedCollectors(r *http.Request) ([]moduleCollector, error) {
+	enabled := enabledCollectors(module)
+	names := r.URL.Query()["collect[]"]
+	if len(names) == 0 {
+		return enabled, nil
+	}
+	var selected []moduleCollector
+	for _, name := range names {
+		if !containsCollector(moduleCollectors, name) {
+			return nil, fmt.Errorf("unknown collector %q", name)
+		}
+		if !containsCollector(enabled, name) {
+			return nil, fmt.Errorf("collector %q is disabled", name)
+		}
+		for _, c := range enabled {
+			if c.name == name {
+				selected = append(selected, c)
+			}
+		}
+	}
+	return selected, nil
+}
+
+// collectorGatherer is a prometheus.Gatherer leaving out the metrics of the
+// collectors that are not selected.
+type collectorGatherer struct {
+	prometheus.Gatherer
+	selected []moduleCollector
+}
+
+// Gather implements prometheus.Gatherer.
+func (g collectorGatherer) Gather() ([]*dto.MetricFamily, error) {
+	mfs, err := g.Gatherer.Gather()
+
+	// Find the names of the metrics of the other collectors
+	others := prometheus.NewRegistry()
+	for _, c := range moduleCollectors {
+		if !containsCollector(g.selected, c.name) {
+			if group, ok := moduleGroups[c.name]; ok {
+				others.MustRegister(group)
+			}
+		}
+	}
+	omitted, errOthers := others.Gather()
+	if errOthers != nil {
+		log.Warn("Error gathering the metrics of unselected collectors: ", errOthers)
+	}
+	names := make(map[string]bool)
+	for _, mf := range omitted {
+		names[mf.GetName()] = true
+	}
+
+	var filtered []*dto.MetricFamily
+	for _, mf := range mfs {
+		if !names[mf.GetName()] {
+			filtered = append(filtered, mf)
+		}
+	}
+	return filtered, err
+}
+
+// containsCollector returns whether a collector named name is in collectors.
+func containsCollector(collectors []moduleCollector, name string) bool {
+	for _, c := range collectors {
+		if c.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// collectorsHandler serves the metrics of the collectors selected by the
+// collect[] query parameters, or of all collectors without them, as
+// node_exporter does.
+type collectorsHandler struct {
+	all http.Handler
+	// newHandler creates the handler serving the metrics of g.
+	newHandler func(g prometheus.Gatherer) http.Handler
+
+	mu sync.Mutex
+	// selections holds the handlers of the selections served so far by the
+	// sorted names of their collectors.
+	selections map[string]http.Handler
+}
+
+// newCollectorsHandler creates a collectorsHandler serving the metrics
+// gathered from prometheus.DefaultGatherer with handlers created by
+// newHandler.
+func newCollectorsHandler(newHandler func(g prometheus.Gatherer) http.Handler) *collectorsHandler {
+	return &collectorsHandler{
+		all:        newHandler(prometheus.DefaultGatherer),
+		newHandler: newHandler,
+		selections: make(map[string]http.Handler),
+	}
+}
+
+// selection returns the handler serving the metrics of the selected
+// collectors, which is created on the first request for the selection.
+func (h *collectorsHandler) selection(selected []moduleCollector) http.Handler {
+	var names []string
+	for _, c := range selected {
+		names = append(names, c.name)
+	}
+	sort.Strings(names)
+	key := strings.Join(names, ",")
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	handler, ok := h.selections[key]
+	if !ok {
+		handler = h.newHandler(collectorGatherer{prometheus.DefaultGatherer, selected})
+		h.selections[key] = handler
+	}
+	return handler
+}
+
+func (h *collectorsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if len(r.URL.Query()["collect[]"]) == 0 {
+		h.all.ServeHTTP(w, r)
+		return
+	}
+	selected, err := requestedCollectors(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.selection(selected).ServeHTTP(w, r)
+}
+
+// listCollectors writes the available collectors, their -modules letter and
+// whether they are enabled to w.
+func listCollectors(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "COLLECTOR\tMODULES\tENABLED\tMETRICS")
+	for _, c := range moduleCollectors {
+		letter := c.flag
+		if letter == "" {
+			letter = "-"
+		}
+		enabled := containsCollector(enabledCollectors(module), c.name)
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\n", c.name, letter, enabled, c.help)
+	}
+	tw.Flush()
+}
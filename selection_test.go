@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+func TestCollectorFlags(t *testing.T) {
+	defer func() { collectorOverrides = map[string]bool{} }()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	registerCollectorFlags(fs)
+	if err := fs.Parse([]string{"--collector.hostdb", "--no-collector.consensus", "-no-collector.daemon=false"}); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, c := range enabledCollectors("cw") {
+		names = append(names, c.name)
+	}
+	if expected := "daemon,hostdb,wallet"; strings.Join(names, ",") != expected {
+		t.Errorf("enabled collectors were incorrect. expected %v got %v", expected, strings.Join(names, ","))
+	}
+
+	if err := fs.Parse([]string{"--collector.miner"}); err == nil {
+		t.Errorf("Parse was incorrect. expected an error for an unknown collector")
+	}
+	if err := validateModules("cghmrtw"); err != nil {
+		t.Errorf("validateModules was incorrect. expected no error got %v", err)
+	}
+	if err := validateModules("cx"); err == nil {
+		t.Errorf("validateModules was incorrect. expected an error for an unknown module")
+	}
+}
+
+func TestCollectorsHandler(t *testing.T) {
+	log = logrus.New()
+	log.SetOutput(ioutil.Discard)
+	defer func(m string) { module = m }(module)
+	module = "cg"
+
+	siad := newFakeSiad(scenarioDir("default"))
+	defer siad.Close()
+	resetAllModuleMetrics()
+	collect(context.Background(), fakeClient(siad.URL), moduleCollectors)
+
+	created := 0
+	handler := newCollectorsHandler(func(g prometheus.Gatherer) http.Handler {
+		created++
+		return newMetricsHandler(g)
+	})
+	scrape := func(query string) (int, string) {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/metrics"+query, nil))
+		return w.Code, w.Body.String()
+	}
+
+	code, body := scrape("?collect[]=consensus")
+	if code != http.StatusOK {
+		t.Fatalf("status was incorrect. expected %v got %v", http.StatusOK, code)
+	}
+	if !strings.Contains(body, "sia_consensus_height ") {
+		t.Errorf("consensus metrics were incorrect. expected them to be served")
+	}
+	if strings.Contains(body, "sia_gateway_") || strings.Contains(body, "sia_daemon_") {
+		t.Errorf("metrics were incorrect. expected only consensus metrics of the modules")
+	}
+	if !strings.Contains(body, "sia_exporter_") {
+		t.Errorf("exporter metrics were incorrect. expected them to be served")
+	}
+
+	// The handler of a selection is reused
+	scrape("?collect[]=gateway&collect[]=consensus")
+	scrape("?collect[]=consensus&collect[]=gateway")
+	scrape("?collect[]=consensus")
+	if created != 3 {
+		t.Errorf("number of handlers was incorrect. expected %v got %v", 3, created)
+	}
+
+	_, body = scrape("")
+	if !strings.Contains(body, "sia_consensus_height ") || !strings.Contains(body, "sia_gateway_") {
+		t.Errorf("metrics were incorrect. expected all collectors without collect[]")
+	}
+
+	// Unknown and disabled collectors are rejected
+	for _, query := range []string{"?collect[]=miner", "?collect[]=wallet"} {
+		if code, _ := scrape(query); code != http.StatusBadRequest {
+			t.Errorf("status of %v was incorrect. expected %v got %v", query, http.StatusBadRequest, code)
+		}
+	}
+}
+
+func TestListCollectors(t *testing.T) {
+	defer func(m string) { module = m }(module)
+	module = "c"
+	var b bytes.Buffer
+	listCollectors(&b)
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != len(moduleCollectors)+1 {
+		t.Fatalf("number of lines was incorrect. expected %v got %v", len(moduleCollectors)+1, len(lines))
+	}
+	for _, line := range lines[1:] {
+		fields := strings.Fields(line)
+		expected := fields[0] == "daemon" || fields[0] == "consensus"
+		if fields[2] != strconv.FormatBool(expected) {
+			t.Errorf("listing of %v was incorrect. expected enabled %v got %v", fields[0], expected, fields[2])
+		}
+	}
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"gitlab.com/NebulousLabs/Sia/modules"
+	"gitlab.com/NebulousLabs/Sia/node/api"
+	"gitlab.com/NebulousLabs/errors"
+)
+
+// siadOptions are the settings of the connection to siad.
+type siadOptions struct {
+	// caFile is a PEM file of the CAs that signed the certificate of siad or
+	// of the TLS reverse proxy in front of it.
+	caFile string
+	// insecureSkipVerify disables the verification of the certificate.
+	insecureSkipVerify bool
+	// proxy is the URL of an HTTP proxy to connect through. Without it the
+	// HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables are used.
+	proxy string
+}
+
+// siadTarget returns the URL of siad at address and the transport that
+// reaches it. address is host:port or an http://, https:// or unix:// URL,
+// e.g. unix:///var/lib/sia/siad.sock.
+func siadTarget(address string, opts siadOptions) (*url.URL, *http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if !strings.Contains(address, "://") {
+		address = "http://" + address
+	}
+	target, err := url.Parse(address)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid siad address: %v", err)
+	}
+
+	switch target.Scheme {
+	case "http":
+	case "https":
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: opts.insecureSkipVerify}
+		if opts.caFile != "" {
+			pem, err := ioutil.ReadFile(opts.caFile)
+			if err != nil {
+				return nil, nil, fmt.Errorf("could not read siad CA file: %v", err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, nil, fmt.Errorf("no certificates found in siad CA file %v", opts.caFile)
+			}
+			transport.TLSClientConfig.RootCAs = pool
+		}
+	case "unix":
+		socket := target.Path
+		transport.Proxy = nil
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		}
+		return &url.URL{Scheme: "http", Host: "siad"}, transport, nil
+	default:
+		return nil, nil, fmt.Errorf("invalid siad address scheme %q, must be http, https or unix", target.Scheme)
+	}
+
+	if opts.proxy != "" {
+		proxy, err := url.Parse(opts.proxy)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid siad proxy: %v", err)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	return &url.URL{Scheme: target.Scheme, Host: target.Host}, transport, nil
+}
+
+// siadClient is an apiClient calling the Sia API with an HTTP client of its
+// own, so that siad can also be reached over TLS, on a Unix socket or through
+// a proxy, which the Sia API client cannot.
+type siadClient struct {
+	target    *url.URL
+	client    *http.Client
+	userAgent string
+	password  string
+}
+
+// newSiadClient creates a siadClient for siad at address, see siadTarget.
+func newSiadClient(address string, opts siadOptions, userAgent string) (*siadClient, error) {
+	target, transport, err := siadTarget(address, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &siadClient{target: target, client: &http.Client{Transport: transport}, userAgent: userAgent}, nil
+}
+
+// withPassword returns a copy of c authenticating with password.
+func (c *siadClient) withPassword(password string) *siadClient {
+	cc := *c
+	cc.password = password
+	return &cc
+}
+
+// get decodes the response of siad to a GET of resource into obj. The
+// request is abandoned when ctx is done. Calls to modules siad did not load
+// return ErrAPICallNotRecognized, other failed calls the message of siad's
+// error.
+func (c *siadClient) get(ctx context.Context, resource string, obj interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.target.String()+resource, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", c.userAgent)
+	if c.password != "" {
+		req.SetBasicAuth("", c.password)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return errors.AddContext(err, "request failed")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return errors.AddContext(ErrAPICallNotRecognized, "unable to perform GET on "+resource)
+	}
+	if resp.StatusCode/100 != 2 {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<16)).Decode(&apiErr); err != nil || apiErr.Message == "" {
+			return fmt.Errorf("siad returned %v", resp.Status)
+		}
+		return errors.New(strings.TrimSpace(apiErr.Message))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(obj); err != nil {
+		return errors.AddContext(err, "could not read response")
+	}
+	return nil
+}
+
+// escapeSiaPath escapes the elements of siaPath for use in a URL path.
+func escapeSiaPath(siaPath modules.SiaPath) string {
+	elems := strings.Split(siaPath.String(), "/")
+	for i, e := range elems {
+		elems[i] = url.PathEscape(e)
+	}
+	return strings.Join(elems, "/")
+}
+
+// ConsensusGet implements apiClient.
+func (c *siadClient) ConsensusGet(ctx context.Context) (cg api.ConsensusGET, err error) {
+	err = c.get(ctx, "/consensus", &cg)
+	return
+}
+
+// DaemonSettingsGet implements apiClient.
+func (c *siadClient) DaemonSettingsGet(ctx context.Context) (dg api.DaemonSettingsGet, err error) {
+	err = c.get(ctx, "/daemon/settings", &dg)
+	return
+}
+
+// GatewayGet implements apiClient.
+func (c *siadClient) GatewayGet(ctx context.Context) (gg api.GatewayGET, err error) {
+	err = c.get(ctx, "/gateway", &gg)
+	return
+}
+
+// HostGet implements apiClient.
+func (c *siadClient) HostGet(ctx context.Context) (hg api.HostGET, err error) {
+	err = c.get(ctx, "/host", &hg)
+	return
+}
+
+// HostStorageGet implements apiClient.
+func (c *siadClient) HostStorageGet(ctx context.Context) (sg api.StorageGET, err error) {
+	err = c.get(ctx, "/host/storage", &sg)
+	return
+}
+
+// HostDbAllGet implements apiClient.
+func (c *siadClient) HostDbAllGet(ctx context.Context) (hdg api.HostdbAllGET, err error) {
+	err = c.get(ctx, "/hostdb/all", &hdg)
+	return
+}
+
+// RenterGet implements apiClient.
+func (c *siadClient) RenterGet(ctx context.Context) (rg api.RenterGET, err error) {
+	err = c.get(ctx, "/renter", &rg)
+	return
+}
+
+// RenterDisabledContractsGet implements apiClient. The expired contracts are
+// requested along with the disabled ones.
+func (c *siadClient) RenterDisabledContractsGet(ctx context.Context) (rc api.RenterContracts, err error) {
+	err = c.get(ctx, "/renter/contracts?disabled=true&expired=true", &rc)
+	return
+}
+
+// RenterDirGet implements apiClient.
+func (c *siadClient) RenterDirGet(ctx context.Context, siaPath modules.SiaPath) (rd api.RenterDirectory, err error) {
+	err = c.get(ctx, "/renter/dir/"+escapeSiaPath(siaPath), &rd)
+	return
+}
+
+// WalletGet implements apiClient.
+func (c *siadClient) WalletGet(ctx context.Context) (wg api.WalletGET, err error) {
+	err = c.get(ctx, "/wallet", &wg)
+	return
+}
+
+// WalletAddressesGet implements apiClient.
+func (c *siadClient) WalletAddressesGet(ctx context.Context) (wag api.WalletAddressesGET, err error) {
+	err = c.get(ctx, "/wallet/addresses", &wag)
+	return
+}
+
+// parseModuleAddresses parses a comma separated list of module=address pairs
+// of the siad modules that are served by a siad of their own, see
+// moduleClient.
+func parseModuleAddresses(s string) (map[string]string, error) {
+	addresses := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[1]) == "" {
+			return nil, fmt.Errorf("invalid module address %q, must be module=address", pair)
+		}
+		module := strings.TrimSpace(kv[0])
+		known := make(map[string]bool)
+		for _, c := range moduleCollectors {
+			if c.siadModule != "" {
+				known[c.siadModule] = true
+			}
+		}
+		if !known[module] {
+			return nil, fmt.Errorf("unknown module %q, must be one of %v", module, moduleList(known))
+		}
+		addresses[module] = strings.TrimSpace(kv[1])
+	}
+	return addresses, nil
+}
+
+// moduleClient is an apiClient calling the endpoints of some modules on other
+// siad instances than the rest, e.g. when the host and the renter run in
+// separate siads on different ports.
+type moduleClient struct {
+	client apiClient
+	// modules holds the clients of the modules served by other siads by
+	// module name.
+	modules map[string]apiClient
+}
+
+// of returns the client of module.
+func (c moduleClient) of(module string) apiClient {
+	if mc, ok := c.modules[module]; ok {
+		return mc
+	}
+	return c.client
+}
+
+// ConsensusGet implements apiClient.
+func (c moduleClient) ConsensusGet(ctx context.Context) (api.ConsensusGET, error) {
+	return c.of("consensus").ConsensusGet(ctx)
+}
+
+// DaemonSettingsGet implements apiClient.
+func (c moduleClient) DaemonSettingsGet(ctx context.Context) (api.DaemonSettingsGet, error) {
+	return c.client.DaemonSettingsGet(ctx)
+}
+
+// GatewayGet implements apiClient.
+func (c moduleClient) GatewayGet(ctx context.Context) (api.GatewayGET, error) {
+	return c.of("gateway").GatewayGet(ctx)
+}
+
+// HostGet implements apiClient.
+func (c moduleClient) HostGet(ctx context.Context) (api.HostGET, error) {
+	return c.of("host").HostGet(ctx)
+}
+
+// HostStorageGet implements apiClient.
+func (c moduleClient) HostStorageGet(ctx context.Context) (api.StorageGET, error) {
+	return c.of("host").HostStorageGet(ctx)
+}
+
+// HostDbAllGet implements apiClient. The hostdb is part of the renter.
+func (c moduleClient) HostDbAllGet(ctx context.Context) (api.HostdbAllGET, error) {
+	return c.of("renter").HostDbAllGet(ctx)
+}
+
+// RenterGet implements apiClient.
+func (c moduleClient) RenterGet(ctx context.Context) (api.RenterGET, error) {
+	return c.of("renter").RenterGet(ctx)
+}
+
+// RenterDisabledContractsGet implements apiClient.
+func (c moduleClient) RenterDisabledContractsGet(ctx context.Context) (api.RenterContracts, error) {
+	return c.of("renter").RenterDisabledContractsGet(ctx)
+}
+
+// RenterDirGet implements apiClient.
+func (c moduleClient) RenterDirGet(ctx context.Context, siaPath modules.SiaPath) (api.RenterDirectory, error) {
+	return c.of("renter").RenterDirGet(ctx, siaPath)
+}
+
+// WalletGet implements apiClient.
+func (c moduleClient) WalletGet(ctx context.Context) (api.WalletGET, error) {
+	return c.of("wallet").WalletGet(ctx)
+}
+
+// WalletAddressesGet implements apiClient.
+func (c moduleClient) WalletAddressesGet(ctx context.Context) (api.WalletAddressesGET, error) {
+	return c.of("wallet").WalletAddressesGet(ctx)
+}
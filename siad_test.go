@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gitlab.com/NebulousLabs/errors"
+)
+
+// consensusHandler answers /consensus for the siad connection tests.
+var consensusHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/consensus" {
+		http.NotFound(w, r)
+		return
+	}
+	fmt.Fprint(w, `{"synced": true, "height": 250000}`)
+})
+
+// checkSiad checks that the consensus of siad at address can be read.
+func checkSiad(t *testing.T, address string, opts siadOptions) {
+	c, err := newSiadClient(address, opts, "Sia-Agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cg, err := c.ConsensusGet(context.Background())
+	if err != nil || cg.Height != 250000 {
+		t.Errorf("consensus of %v was incorrect. expected height %v got %v (%v)", address, 250000, cg.Height, err)
+	}
+}
+
+func TestSiadTLS(t *testing.T) {
+	server := httptest.NewTLSServer(consensusHandler)
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "sia_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	caFile := filepath.Join(dir, "ca.pem")
+	ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600)
+
+	checkSiad(t, server.URL, siadOptions{caFile: caFile})
+	checkSiad(t, server.URL, siadOptions{insecureSkipVerify: true})
+
+	// Without the CA the certificate is rejected
+	c, err := newSiadClient(server.URL, siadOptions{}, "Sia-Agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.ConsensusGet(context.Background()); err == nil {
+		t.Errorf("consensus was incorrect. expected an error for an unknown CA")
+	}
+}
+
+func TestSiadUnixSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sia_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "siad.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skip("Unix sockets are not supported: ", err)
+	}
+	go http.Serve(l, consensusHandler)
+	defer l.Close()
+
+	checkSiad(t, "unix://"+socket, siadOptions{})
+}
+
+func TestSiadTarget(t *testing.T) {
+	target, transport, err := siadTarget("127.0.0.1:9980", siadOptions{proxy: "http://proxy:3128"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("GET", target.String()+"/consensus", nil)
+	if proxy, _ := transport.Proxy(req); proxy == nil || proxy.Host != "proxy:3128" {
+		t.Errorf("proxy was incorrect. expected %v got %v", "proxy:3128", proxy)
+	}
+	if _, _, err := siadTarget("ftp://siad", siadOptions{}); err == nil {
+		t.Errorf("siadTarget was incorrect. expected an error for scheme ftp")
+	}
+}
+
+func TestParseModuleAddresses(t *testing.T) {
+	addresses, err := parseModuleAddresses("host=127.0.0.1:9990, renter=unix:///var/lib/sia/renter.sock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{"host": "127.0.0.1:9990", "renter": "unix:///var/lib/sia/renter.sock"}
+	if fmt.Sprint(addresses) != fmt.Sprint(expected) {
+		t.Errorf("module addresses were incorrect. expected %v got %v", expected, addresses)
+	}
+	for _, s := range []string{"host", "host=", "miner=127.0.0.1:9990"} {
+		if _, err := parseModuleAddresses(s); err == nil {
+			t.Errorf("parseModuleAddresses was incorrect. expected an error for %q", s)
+		}
+	}
+}
+
+func TestModuleClient(t *testing.T) {
+	siad := newFakeSiad(scenarioDir("default"), scenarioDir("module_not_loaded"))
+	defer siad.Close()
+	host := newFakeSiad(scenarioDir("default"))
+	defer host.Close()
+
+	// The host is called on its own siad, the rest on the main siad
+	c := moduleClient{client: fakeClient(siad.URL), modules: map[string]apiClient{"host": fakeClient(host.URL)}}
+	if _, err := c.HostGet(context.Background()); err != nil {
+		t.Errorf("host was incorrect. expected no error got %v", err)
+	}
+	if _, err := c.WalletGet(context.Background()); !errors.Contains(err, ErrAPICallNotRecognized) {
+		t.Errorf("wallet was incorrect. expected %v got %v", ErrAPICallNotRecognized, err)
+	}
+}
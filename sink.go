@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	dto "github.com/prometheus/client_model/go"
+)
+
+var (
+	sinkErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "sia_exporter_sink_errors_total", Help: "Number of failed sends of the metrics to a sink"}, []string{"sink"})
+	sinkLastSuccess = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "sia_exporter_sink_last_success_timestamp_seconds", Help: "Unix time of the last successful send of the metrics to a sink"}, []string{"sink"})
+
+	// sinkGatherer gathers the metrics sent to the sinks. Legacy metric names
+	// are only served on /metrics, for the dashboards built on them.
+	sinkGatherer prometheus.Gatherer = prometheus.DefaultGatherer
+
+	// sinks receive the metrics after every refresh.
+	sinks []sink
+
+	// sinkRetries is how often a sink retries a failed send.
+	sinkRetries = 3
+	// sinkBackoff is the time waited before the first retry of a failed send.
+	// It doubles with every further retry.
+	sinkBackoff = time.Second
+)
+
+// sink is a destination the metrics are pushed to, for setups in which they
+// cannot be scraped.
+type sink interface {
+	// Name identifies the sink in logs and self-metrics.
+	Name() string
+	// Send sends the gathered metrics, retrying failed sends with retry.
+	Send(ctx context.Context, mfs []*dto.MetricFamily) error
+}
+
+// sendToSinks gathers the metrics and sends them to all sinks.
+func sendToSinks(ctx context.Context) {
+	if len(sinks) == 0 {
+		return
+	}
+	mfs, err := sinkGatherer.Gather()
+	if err != nil {
+		log.Warn("Error gathering metrics: ", err)
+	}
+	for _, s := range sinks {
+		if err := s.Send(ctx, mfs); err != nil {
+			log.Warn("Could not send metrics to ", s.Name(), ": ", err)
+			sinkErrors.WithLabelValues(s.Name()).Inc()
+			continue
+		}
+		sinkLastSuccess.WithLabelValues(s.Name()).SetToCurrentTime()
+	}
+}
+
+// closeSinks releases the connections held by the sinks that hold any.
+func closeSinks() {
+	for _, s := range sinks {
+		if c, ok := s.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				log.Debug("Error closing ", s.Name(), ": ", err)
+			}
+		}
+	}
+}
+
+// permanentError is an error of a send that will fail again when retried,
+// e.g. because the receiver rejected the metrics.
+type permanentError struct {
+	error
+}
+
+// classifyHTTPStatus returns the error of a send the receiver answered with
+// resp: nil for a 2xx status, a permanentError for a 4xx status other than
+// 429 and an error to retry otherwise.
+func classifyHTTPStatus(resp *http.Response) error {
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+	err := fmt.Errorf("server returned %v: %s", resp.Status, bytes.TrimSpace(msg))
+	if resp.StatusCode/100 == 4 && resp.StatusCode != http.StatusTooManyRequests {
+		return permanentError{err}
+	}
+	return err
+}
+
+// finite returns whether v is neither NaN nor infinite, which most sinks
+// cannot represent.
+func finite(v float64) bool {
+	return !math.IsNaN(v) && !math.IsInf(v, 0)
+}
+
+// retry calls f until it succeeds, it failed sinkRetries+1 times, it returned
+// a permanentError or ctx is done, waiting sinkBackoff before the first retry
+// and twice as long before every further one.
+func retry(ctx context.Context, f func() error) error {
+	backoff := sinkBackoff
+	err := f()
+	for i := 0; err != nil && i < sinkRetries; i++ {
+		if _, ok := err.(permanentError); ok {
+			return err
+		}
+		log.Debug("Retrying in ", backoff, " after error: ", err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return err
+		}
+		backoff *= 2
+		err = f()
+	}
+	return err
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	// stalePolicyKeep keeps exporting the last good values of a module whose
+	// collection failed and flags them with sia_exporter_module_stale.
+	stalePolicyKeep = "keep"
+	// stalePolicyOmit omits the series of a module whose collection failed
+	// until it is collected successfully again.
+	stalePolicyOmit = "omit"
+)
+
+var (
+	// stalePolicy is what to export for a module whose collection failed.
+	stalePolicy = stalePolicyKeep
+
+	// moduleGroups holds the metric group of every module by module name.
+	moduleGroups = map[string]*moduleMetrics{}
+
+	moduleStale = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "sia_exporter_module_stale", Help: "Are the values of a module stale because its last collection failed. 0=fresh.  1=stale"}, []string{"module"})
+)
+
+// Register the module groups once all their metrics have been created.
+func init() {
+	for _, g := range moduleGroups {
+		prometheus.MustRegister(g)
+	}
+}
+
+// validateStalePolicy returns an error if policy is not a known stale policy.
+func validateStalePolicy(policy string) error {
+	if policy != stalePolicyKeep && policy != stalePolicyOmit {
+		return fmt.Errorf("unknown stale policy %q, must be %q or %q", policy, stalePolicyKeep, stalePolicyOmit)
+	}
+	return nil
+}
+
+// moduleMetrics groups the metrics of a module so that they can be withheld
+// from scrapes while the module's values are not trustworthy. It is a
+// prometheus.Registerer for creating the metrics with promauto.With and a
+// prometheus.Collector for registering the group as a whole.
+type moduleMetrics struct {
+	name       string
+	collectors []prometheus.Collector
+
+	mu sync.Mutex
+	// collected is true once the module has been collected successfully.
+	collected bool
+	// failed is true if the last collection of the module failed.
+	failed bool
+}
+
+// newModuleMetrics creates the metric group of a module.
+func newModuleMetrics(name string) *moduleMetrics {
+	g := &moduleMetrics{name: name}
+	moduleGroups[name] = g
+	return g
+}
+
+// Register implements prometheus.Registerer.
+func (g *moduleMetrics) Register(c prometheus.Collector) error {
+	g.collectors = append(g.collectors, c)
+	return nil
+}
+
+// MustRegister implements prometheus.Registerer.
+func (g *moduleMetrics) MustRegister(cs ...prometheus.Collector) {
+	g.collectors = append(g.collectors, cs...)
+}
+
+// Unregister implements prometheus.Registerer.
+func (g *moduleMetrics) Unregister(c prometheus.Collector) bool {
+	for i, collector := range g.collectors {
+		if collector == c {
+			g.collectors = append(g.collectors[:i], g.collectors[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Describe implements prometheus.Collector.
+func (g *moduleMetrics) Describe(ch chan<- *prometheus.Desc) {
+	for _, c := range g.collectors {
+		c.Describe(ch)
+	}
+}
+
+// Collect implements prometheus.Collector. Nothing is collected before the
+// module's first successful collection, so that the initial zero values are
+// never exported, nor while its collection fails under the omit policy.
+func (g *moduleMetrics) Collect(ch chan<- prometheus.Metric) {
+	if !g.exported() {
+		return
+	}
+	for _, c := range g.collectors {
+		c.Collect(ch)
+	}
+}
+
+// exported returns whether the group's metrics are currently exported.
+func (g *moduleMetrics) exported() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.collected && !(g.failed && stalePolicy == stalePolicyOmit)
+}
+
+// setResult records the outcome of a collection of the module.
+func (g *moduleMetrics) setResult(err error) {
+	g.mu.Lock()
+	g.failed = err != nil
+	g.collected = g.collected || err == nil
+	g.mu.Unlock()
+	moduleStale.WithLabelValues(g.name).Set(boolToFloat64(err != nil))
+}
+
+// reset withholds the group's metrics until the module is collected
+// successfully again, e.g. after siad unloaded it.
+func (g *moduleMetrics) reset() {
+	g.mu.Lock()
+	g.collected, g.failed = false, false
+	g.mu.Unlock()
+	moduleStale.DeleteLabelValues(g.name)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+)
+
+// resetModuleMetrics makes g forget about earlier collections.
+func resetModuleMetrics(g *moduleMetrics) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.collected, g.failed = false, false
+}
+
+func TestNoZeroSpikeOnFailure(t *testing.T) {
+	log = logrus.New()
+	defer func() { stalePolicy = stalePolicyKeep }()
+
+	for _, policy := range []string{stalePolicyKeep, stalePolicyOmit} {
+		stalePolicy = policy
+		resetModuleMetrics(renterGroup)
+		siad := newFakeSiad(scenarioDir("default"))
+		sc := fakeClient(siad.URL)
+
+		collectModule(context.Background(), "renter", renterMetrics, sc)
+		series := testutil.CollectAndCount(renterGroup)
+		if series == 0 {
+			t.Fatalf("%v: renter series were not exported after a successful collection", policy)
+		}
+
+		// Every failing endpoint must leave the earlier values untouched
+		for _, path := range []string{"/renter/dir/", "/renter/contracts", "/renter"} {
+			siad.setFailing(path, true)
+			collectModule(context.Background(), "renter", renterMetrics, sc)
+			siad.setFailing(path, false)
+
+			if v := testutil.ToFloat64(moduleStale.WithLabelValues("renter")); v != 1 {
+				t.Errorf("%v %v: stale marker was incorrect. expected %v got %v", policy, path, 1, v)
+			}
+			n := testutil.CollectAndCount(renterGroup)
+			if policy == stalePolicyOmit && n != 0 {
+				t.Errorf("%v %v: series count was incorrect. expected %v got %v", policy, path, 0, n)
+			}
+			if policy == stalePolicyKeep && n != series {
+				t.Errorf("%v %v: series count was incorrect. expected %v got %v", policy, path, series, n)
+			}
+			if v := testutil.ToFloat64(renterAllowanceAmount.Gauge); v != 5000 {
+				t.Errorf("%v %v: allowance amount was incorrect. expected %v got %v", policy, path, 5000, v)
+			}
+			if v := testutil.ToFloat64(renterNumActiveContracts); v != 4 {
+				t.Errorf("%v %v: active contracts was incorrect. expected %v got %v", policy, path, 4, v)
+			}
+			if v := testutil.ToFloat64(renterAggregateNumFiles); v != 42 {
+				t.Errorf("%v %v: number of files was incorrect. expected %v got %v", policy, path, 42, v)
+			}
+		}
+
+		// Recovering clears the stale marker and exports the series again
+		collectModule(context.Background(), "renter", renterMetrics, sc)
+		if v := testutil.ToFloat64(moduleStale.WithLabelValues("renter")); v != 0 {
+			t.Errorf("%v: stale marker was incorrect. expected %v got %v", policy, 0, v)
+		}
+		if n := testutil.CollectAndCount(renterGroup); n != series {
+			t.Errorf("%v: series count was incorrect. expected %v got %v", policy, series, n)
+		}
+		siad.Close()
+	}
+}
+
+func TestNoRootDirectory(t *testing.T) {
+	log = logrus.New()
+	log.SetOutput(ioutil.Discard)
+	resetModuleMetrics(renterGroup)
+
+	dir, err := ioutil.TempDir("", "sia_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "renter_dir.json"), []byte(`{"directories": []}`), 0600)
+
+	siad := newFakeSiad(scenarioDir("default"), dir)
+	defer siad.Close()
+	if err := collectModule(context.Background(), "renter", renterMetrics, fakeClient(siad.URL)); err == nil {
+		t.Errorf("collection was incorrect. expected an error for a missing root directory")
+	}
+	if n := testutil.CollectAndCount(renterGroup); n != 0 {
+		t.Errorf("series count was incorrect. expected %v got %v", 0, n)
+	}
+}
+
+func TestNothingExportedBeforeFirstCollection(t *testing.T) {
+	log = logrus.New()
+	resetModuleMetrics(consensusGroup)
+
+	siad := newFakeSiad(scenarioDir("default"))
+	defer siad.Close()
+	sc := fakeClient(siad.URL)
+
+	siad.setFailing("/consensus", true)
+	collectModule(context.Background(), "consensus", consensusMetrics, sc)
+	if n := testutil.CollectAndCount(consensusGroup); n != 0 {
+		t.Errorf("series count was incorrect. expected %v got %v", 0, n)
+	}
+
+	siad.setFailing("/consensus", false)
+	collectModule(context.Background(), "consensus", consensusMetrics, sc)
+	if v := testutil.ToFloat64(consensusHeight); v != 250000 {
+		t.Errorf("consensus height was incorrect. expected %v got %v", 250000, v)
+	}
+}
+
+func TestUnloadedModuleWithheld(t *testing.T) {
+	log = logrus.New()
+	log.SetOutput(ioutil.Discard)
+	resetAllModuleMetrics()
+
+	siad := newFakeSiad(scenarioDir("default"))
+	defer siad.Close()
+	collectModule(context.Background(), "renter", renterMetrics, fakeClient(siad.URL))
+	if !renterGroup.exported() {
+		t.Fatalf("renter metrics were incorrect. expected them to be exported")
+	}
+
+	// siad restarted without the renter
+	unloaded := newFakeSiad(scenarioDir("default"), scenarioDir("module_not_loaded"))
+	defer unloaded.Close()
+	if err := collectModule(context.Background(), "renter", renterMetrics, fakeClient(unloaded.URL)); err != nil {
+		t.Errorf("collection was incorrect. expected no error got %v", err)
+	}
+	if n := testutil.CollectAndCount(renterGroup); n != 0 {
+		t.Errorf("series count was incorrect. expected %v got %v", 0, n)
+	}
+	if v := testutil.ToFloat64(scrapeSuccess.WithLabelValues("renter")); v != 1 {
+		t.Errorf("scrape success was incorrect. expected %v got %v", 1, v)
+	}
+}
+
+func TestValidateStalePolicy(t *testing.T) {
+	for _, policy := range []string{stalePolicyKeep, stalePolicyOmit} {
+		if err := validateStalePolicy(policy); err != nil {
+			t.Errorf("validateStalePolicy(%q) was incorrect. expected no error got %v", policy, err)
+		}
+	}
+	if err := validateStalePolicy("zero"); err == nil {
+		t.Errorf("validateStalePolicy(%q) was incorrect. expected an error", "zero")
+	}
+}
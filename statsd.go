@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// statsdMaxPacket is the maximum size of a StatsD packet, small enough to not
+// be fragmented on common networks.
+const statsdMaxPacket = 1432
+
+// statsdSink emits the metrics as StatsD gauges and counters over UDP, with
+// the labels as DogStatsD tags.
+type statsdSink struct {
+	addr string
+
+	// last holds the last value of every counter series, as StatsD counters
+	// are increments.
+	mu   sync.Mutex
+	last map[string]float64
+}
+
+// newStatsdSink creates a statsdSink emitting to the StatsD server at addr.
+func newStatsdSink(addr string) *statsdSink {
+	return &statsdSink{addr: addr, last: make(map[string]float64)}
+}
+
+// Name implements sink.
+func (s *statsdSink) Name() string {
+	return "statsd"
+}
+
+// Send implements sink. UDP sends are not retried, as a lost packet is not
+// reported anyway.
+func (s *statsdSink) Send(ctx context.Context, mfs []*dto.MetricFamily) error {
+	var d net.Dialer
+	dialCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	conn, err := d.DialContext(dialCtx, "udp", s.addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	for _, packet := range statsdPackets(s.lines(mfs), statsdMaxPacket) {
+		if _, err := conn.Write(packet); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lines renders the metric families as StatsD lines. Prometheus counters and
+// the cumulative samples of histograms and summaries become counters of the
+// increase since the last send, all other samples gauges. The first send of a
+// counter only records its value.
+func (s *statsdSink) lines(mfs []*dto.MetricFamily) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var lines []string
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			for _, sample := range flattenMetric(mf, m) {
+				if !finite(sample.value) {
+					continue
+				}
+				tags := statsdTags(m.GetLabel(), sample.labels)
+				if !statsdCumulative(mf.GetType(), sample) {
+					lines = append(lines, sample.name+":"+formatFloat(sample.value)+"|g"+tags)
+					continue
+				}
+				key := sample.name + tags
+				last, ok := s.last[key]
+				s.last[key] = sample.value
+				if !ok {
+					continue
+				}
+				delta := sample.value - last
+				if delta < 0 {
+					// The counter was reset
+					delta = sample.value
+				}
+				lines = append(lines, sample.name+":"+formatFloat(delta)+"|c"+tags)
+			}
+		}
+	}
+	return lines
+}
+
+// statsdCumulative returns whether a sample of a metric of type t only ever
+// increases.
+func statsdCumulative(t dto.MetricType, sample flatSample) bool {
+	switch t {
+	case dto.MetricType_COUNTER:
+		return true
+	case dto.MetricType_SUMMARY, dto.MetricType_HISTOGRAM:
+		// All samples but the quantiles of summaries
+		_, ok := sample.labels["quantile"]
+		return !ok
+	}
+	return false
+}
+
+// statsdTags renders the labels of a metric and the extra labels of a sample
+// as DogStatsD tags, sorted by name, including the leading "|#".
+func statsdTags(labels []*dto.LabelPair, extra map[string]string) string {
+	var tags []string
+	for _, lp := range labels {
+		tags = append(tags, statsdEscape(lp.GetName())+":"+statsdEscape(lp.GetValue()))
+	}
+	for name, value := range extra {
+		tags = append(tags, statsdEscape(name)+":"+statsdEscape(value))
+	}
+	if len(tags) == 0 {
+		return ""
+	}
+	sort.Strings(tags)
+	return "|#" + strings.Join(tags, ",")
+}
+
+// statsdEscape replaces the characters separating the parts of a DogStatsD
+// line in a tag.
+var statsdEscape = strings.NewReplacer("|", "_", ",", "_", "#", "_", "\n", "_").Replace
+
+// statsdPackets joins lines into newline separated packets of at most max
+// bytes. Longer lines get a packet of their own.
+func statsdPackets(lines []string, max int) [][]byte {
+	var packets [][]byte
+	var buf bytes.Buffer
+	for _, line := range lines {
+		if buf.Len() > 0 && buf.Len()+1+len(line) > max {
+			packets = append(packets, append([]byte(nil), buf.Bytes()...))
+			buf.Reset()
+		}
+		if buf.Len() > 0 {
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(line)
+	}
+	if buf.Len() > 0 {
+		packets = append(packets, buf.Bytes())
+	}
+	return packets
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestStatsdSink(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	s := newStatsdSink(conn.LocalAddr().String())
+
+	reg := prometheus.NewRegistry()
+	height := prometheus.NewGauge(prometheus.GaugeOpts{Name: "sia_consensus_height", Help: "test"})
+	errs := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "sia_exporter_api_errors_total", Help: "test"}, []string{"module"})
+	reg.MustRegister(height, errs)
+
+	// receive sends the metrics and returns the received lines
+	receive := func() []string {
+		mfs, _ := reg.Gather()
+		if err := s.Send(context.Background(), mfs); err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, statsdMaxPacket)
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.Split(string(buf[:n]), "\n")
+	}
+
+	// Counters are first only recorded
+	height.Set(250000)
+	errs.WithLabelValues("host|db").Add(3)
+	lines := receive()
+	if len(lines) != 1 || lines[0] != "sia_consensus_height:250000|g" {
+		t.Errorf("lines were incorrect. expected %v got %v", "sia_consensus_height:250000|g", lines)
+	}
+
+	// and then sent as increments
+	errs.WithLabelValues("host|db").Add(2)
+	lines = receive()
+	expected := "sia_consensus_height:250000|g,sia_exporter_api_errors_total:2|c|#module:host_db"
+	if strings.Join(lines, ",") != expected {
+		t.Errorf("lines were incorrect. expected %v got %v", expected, lines)
+	}
+}
+
+func TestStatsdPackets(t *testing.T) {
+	packets := statsdPackets([]string{"a:1|g", "b:2|g", "c:3|g", strings.Repeat("d", 20)}, 11)
+	expected := []string{"a:1|g\nb:2|g", "c:3|g", strings.Repeat("d", 20)}
+	if len(packets) != len(expected) {
+		t.Fatalf("number of packets was incorrect. expected %v got %v", len(expected), len(packets))
+	}
+	for i, p := range packets {
+		if string(p) != expected[i] {
+			t.Errorf("packet %v was incorrect. expected %q got %q", i, expected[i], p)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// collectionStatus is the outcome of the last collection of a module.
+type collectionStatus struct {
+	last        time.Time
+	lastSuccess time.Time
+	duration    time.Duration
+	err         error
+}
+
+var (
+	statusMu sync.Mutex
+	// collectionStatuses holds the collectionStatus of every module that was
+	// collected by module name.
+	collectionStatuses = map[string]*collectionStatus{}
+)
+
+// recordStatus records the outcome of a collection of a module for the status
+// endpoints.
+func recordStatus(name string, duration time.Duration, err error) {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	s, ok := collectionStatuses[name]
+	if !ok {
+		s = &collectionStatus{}
+		collectionStatuses[name] = s
+	}
+	s.last = time.Now()
+	s.duration = duration
+	s.err = err
+	if err == nil {
+		s.lastSuccess = s.last
+	}
+}
+
+// statusSnapshot is what /status.json serves: the last collection of every
+// enabled module along with the values it exports.
+type statusSnapshot struct {
+	Time    time.Time      `json:"time"`
+	Modules []moduleStatus `json:"modules"`
+}
+
+// moduleStatus is the last collection of a module.
+type moduleStatus struct {
+	Name            string        `json:"name"`
+	LastCollection  *time.Time    `json:"last_collection,omitempty"`
+	LastSuccess     *time.Time    `json:"last_success,omitempty"`
+	DurationSeconds float64       `json:"duration_seconds"`
+	Error           string        `json:"error,omitempty"`
+	Stale           bool          `json:"stale"`
+	Metrics         []metricValue `json:"metrics"`
+}
+
+// metricValue is a sample exported for a module.
+type metricValue struct {
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Value  float64           `json:"value"`
+}
+
+// newStatusSnapshot takes a snapshot of the status of the collectors. Samples
+// that JSON cannot represent, i.e. NaN and infinite values, are left out.
+func newStatusSnapshot(collectors []moduleCollector) statusSnapshot {
+	snapshot := statusSnapshot{Time: time.Now(), Modules: []moduleStatus{}}
+	for _, c := range collectors {
+		ms := moduleStatus{Name: c.name, Metrics: []metricValue{}}
+		statusMu.Lock()
+		if s, ok := collectionStatuses[c.name]; ok {
+			last := s.last
+			ms.LastCollection = &last
+			if !s.lastSuccess.IsZero() {
+				lastSuccess := s.lastSuccess
+				ms.LastSuccess = &lastSuccess
+			}
+			ms.DurationSeconds = s.duration.Seconds()
+			if s.err != nil {
+				ms.Error = s.err.Error()
+				ms.Stale = true
+			}
+		}
+		statusMu.Unlock()
+		if g, ok := moduleGroups[c.name]; ok {
+			ms.Metrics = moduleValues(g)
+		}
+		snapshot.Modules = append(snapshot.Modules, ms)
+	}
+	return snapshot
+}
+
+// moduleValues returns the samples currently exported for the metric group of
+// a module, sorted by name.
+func moduleValues(g *moduleMetrics) []metricValue {
+	values := []metricValue{}
+	reg := prometheus.NewRegistry()
+	if err := reg.Register(g); err != nil {
+		log.Debug("Error registering ", g.name, " metrics for status: ", err)
+		return values
+	}
+	mfs, err := reg.Gather()
+	if err != nil {
+		log.Debug("Error gathering ", g.name, " metrics for status: ", err)
+	}
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			for _, s := range flattenMetric(mf, m) {
+				if !finite(s.value) {
+					continue
+				}
+				labels := make(map[string]string)
+				for _, lp := range m.GetLabel() {
+					labels[lp.GetName()] = lp.GetValue()
+				}
+				for name, value := range s.labels {
+					labels[name] = value
+				}
+				if len(labels) == 0 {
+					labels = nil
+				}
+				values = append(values, metricValue{Name: s.name, Labels: labels, Value: s.value})
+			}
+		}
+	}
+	sort.SliceStable(values, func(i, j int) bool { return values[i].Name < values[j].Name })
+	return values
+}
+
+// statusJSONHandler serves the status snapshot of the enabled collectors as
+// JSON.
+func statusJSONHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(newStatusSnapshot(loadedCollectors(enabledCollectors(module)))); err != nil {
+		log.Warn("Error encoding status: ", err)
+	}
+}
+
+// statusTemplate renders a status snapshot as HTML page.
+var statusTemplate = template.Must(template.New("status").Funcs(template.FuncMap{
+	"time": func(t *time.Time) string {
+		if t == nil {
+			return "never"
+		}
+		return t.Format("2006-01-02 15:04:05 MST")
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>sia_exporter</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+td, th { border: 1px solid #ccc; padding: 0.2em 0.6em; text-align: left; }
+.failed { color: #b00; }
+.ok { color: #070; }
+</style>
+</head>
+<body>
+<h1>sia_exporter</h1>
+<p>Status as of {{.Time.Format "2006-01-02 15:04:05 MST"}}. <a href="/metrics">Metrics</a> <a href="/status.json">JSON</a></p>
+<table>
+<tr><th>Module</th><th>Last collection</th><th>Last success</th><th>Duration</th><th>Status</th></tr>
+{{range .Modules}}<tr>
+<td><a href="#{{.Name}}">{{.Name}}</a></td>
+<td>{{time .LastCollection}}</td>
+<td>{{time .LastSuccess}}</td>
+<td>{{printf "%.3fs" .DurationSeconds}}</td>
+<td>{{if .Error}}<span class="failed">failed: {{.Error}}</span>{{else if .LastCollection}}<span class="ok">ok</span>{{else}}not collected yet{{end}}</td>
+</tr>
+{{end}}</table>
+{{range .Modules}}<h2 id="{{.Name}}">{{.Name}}</h2>
+{{if .Metrics}}<table>
+<tr><th>Metric</th><th>Labels</th><th>Value</th></tr>
+{{range .Metrics}}<tr><td>{{.Name}}</td><td>{{range $name, $value := .Labels}}{{$name}}="{{$value}}" {{end}}</td><td>{{.Value}}</td></tr>
+{{end}}</table>
+{{else}}<p>No values.</p>
+{{end}}{{end}}</body>
+</html>
+`))
+
+// statusHTMLHandler serves the status snapshot of the enabled collectors as
+// a simple dashboard on /.
+func statusHTMLHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := statusTemplate.Execute(w, newStatusSnapshot(loadedCollectors(enabledCollectors(module)))); err != nil {
+		log.Warn("Error rendering status: ", err)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestStatusJSON(t *testing.T) {
+	log = logrus.New()
+	resetModuleMetrics(consensusGroup)
+	defer func(m string) { module = m }(module)
+	module = "c"
+
+	siad := newFakeSiad(scenarioDir("default"))
+	defer siad.Close()
+	sc := fakeClient(siad.URL)
+
+	// status returns the consensus module of the served status
+	status := func() moduleStatus {
+		w := httptest.NewRecorder()
+		statusJSONHandler(w, httptest.NewRequest("GET", "/status.json", nil))
+		var snapshot statusSnapshot
+		if err := json.Unmarshal(w.Body.Bytes(), &snapshot); err != nil {
+			t.Fatal(err)
+		}
+		for _, ms := range snapshot.Modules {
+			if ms.Name == "consensus" {
+				return ms
+			}
+		}
+		t.Fatalf("status was incorrect. expected consensus module got %v", snapshot.Modules)
+		return moduleStatus{}
+	}
+
+	collectModule(context.Background(), "consensus", consensusMetrics, sc)
+	ms := status()
+	if ms.Error != "" || ms.Stale || ms.LastSuccess == nil {
+		t.Errorf("consensus status was incorrect. expected a success got %+v", ms)
+	}
+	height := false
+	for _, v := range ms.Metrics {
+		if v.Name == "sia_consensus_height" && v.Value == 250000 {
+			height = true
+		}
+	}
+	if !height {
+		t.Errorf("consensus values were incorrect. expected sia_consensus_height 250000 got %v", ms.Metrics)
+	}
+
+	siad.setFailing("/consensus", true)
+	collectModule(context.Background(), "consensus", consensusMetrics, sc)
+	ms = status()
+	if !strings.Contains(ms.Error, "internal error") || !ms.Stale || ms.LastSuccess == nil || !ms.LastCollection.After(*ms.LastSuccess) {
+		t.Errorf("consensus status was incorrect. expected a failure after a success got %+v", ms)
+	}
+}
+
+func TestStatusHTML(t *testing.T) {
+	log = logrus.New()
+	w := httptest.NewRecorder()
+	statusHTMLHandler(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != 200 || !strings.Contains(w.Body.String(), `<h2 id="daemon">daemon</h2>`) {
+		t.Errorf("status page was incorrect. expected the daemon module got %v\n%v", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	statusHTMLHandler(w, httptest.NewRequest("GET", "/nothing", nil))
+	if w.Code != 404 {
+		t.Errorf("status code was incorrect. expected %v got %v", 404, w.Code)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	kitlog "github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/exporter-toolkit/web"
+	"github.com/sirupsen/logrus"
+)
+
+// toolkitLogger passes the log lines of the exporter-toolkit, which logs
+// key/value pairs through go-kit, on to log.
+func toolkitLogger() kitlog.Logger {
+	return kitlog.LoggerFunc(func(keyvals ...interface{}) error {
+		lvl := logrus.InfoLevel
+		msg := ""
+		fields := logrus.Fields{}
+		for i := 0; i+1 < len(keyvals); i += 2 {
+			key := fmt.Sprint(keyvals[i])
+			switch {
+			case keyvals[i] == level.Key():
+				if l, err := logrus.ParseLevel(fmt.Sprint(keyvals[i+1])); err == nil {
+					lvl = l
+				}
+			case key == "msg":
+				msg = fmt.Sprint(keyvals[i+1])
+			default:
+				fields[key] = keyvals[i+1]
+			}
+		}
+		log.WithFields(fields).Log(lvl, msg)
+		return nil
+	})
+}
+
+// listenAddresses returns the addresses to serve on from a comma separated
+// list, falling back to all interfaces on port.
+func listenAddresses(addresses string, port int) []string {
+	var list []string
+	for _, address := range strings.Split(addresses, ",") {
+		if address = strings.TrimSpace(address); address != "" {
+			list = append(list, address)
+		}
+	}
+	if len(list) == 0 {
+		list = []string{net.JoinHostPort("", fmt.Sprint(port))}
+	}
+	return list
+}
+
+// validateWebConfig checks the web configuration file, including that its
+// certificates can be loaded.
+func validateWebConfig(configFile string) error {
+	if err := web.Validate(configFile); err != nil {
+		return fmt.Errorf("invalid web configuration %v: %v", configFile, err)
+	}
+	return nil
+}
+
+// serveWeb serves the registered handlers with server on addresses.
+// configFile is a web configuration file in the exporter-toolkit format, which
+// enables TLS, client certificate authentication and basic authentication with
+// bcrypt hashed passwords. Certificates are reloaded from disk for every new
+// connection, so renewed certificates are picked up without a restart.
+func serveWeb(server *http.Server, addresses []string, configFile string) error {
+	return web.ListenAndServe(server, &web.FlagConfig{
+		WebListenAddresses: &addresses,
+		WebConfigFile:      &configFile,
+	}, toolkitLogger())
+}
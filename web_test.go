@@ -0,0 +1,123 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// writeCertificate writes a self-signed certificate for 127.0.0.1 and its key
+// into dir.
+func writeCertificate(t *testing.T, dir string) (certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "sia_exporter"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	return certFile, keyFile
+}
+
+func TestServeWeb(t *testing.T) {
+	log = logrus.New()
+	log.SetOutput(ioutil.Discard)
+	dir, err := ioutil.TempDir("", "sia_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	certFile, keyFile := writeCertificate(t, dir)
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configFile := filepath.Join(dir, "web-config.yml")
+	config := fmt.Sprintf("tls_server_config:\n  cert_file: %v\n  key_file: %v\nbasic_auth_users:\n  prometheus: %s\n", certFile, keyFile, hash)
+	if err := ioutil.WriteFile(configFile, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := validateWebConfig(configFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := validateWebConfig(filepath.Join(dir, "missing.yml")); err == nil {
+		t.Errorf("validateWebConfig was incorrect. expected an error for a missing file")
+	}
+
+	address := freeAddress(t)
+	http.HandleFunc("/web-test", func(w http.ResponseWriter, r *http.Request) { fmt.Fprint(w, "ok") })
+	go serveWeb(&http.Server{}, []string{address}, configFile)
+
+	pool := x509.NewCertPool()
+	caPEM, _ := ioutil.ReadFile(certFile)
+	pool.AppendCertsFromPEM(caPEM)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+	// get returns the status code of a request with the password
+	get := func(password string) int {
+		req, _ := http.NewRequest("GET", "https://"+address+"/web-test", nil)
+		if password != "" {
+			req.SetBasicAuth("prometheus", password)
+		}
+		var resp *http.Response
+		for i := 0; i < 50; i++ {
+			if resp, err = client.Do(req); err == nil {
+				break
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	for _, c := range []struct {
+		password string
+		code     int
+	}{{"", 401}, {"wrong", 401}, {"secret", 200}} {
+		if code := get(c.password); code != c.code {
+			t.Errorf("status code with password %q was incorrect. expected %v got %v", c.password, c.code, code)
+		}
+	}
+}
+
+func TestListenAddresses(t *testing.T) {
+	if a := listenAddresses("", 9983); len(a) != 1 || a[0] != ":9983" {
+		t.Errorf("listenAddresses was incorrect. expected %v got %v", []string{":9983"}, a)
+	}
+	if a := listenAddresses("127.0.0.1:9983, [::1]:9983", 9983); len(a) != 2 || a[1] != "[::1]:9983" {
+		t.Errorf("listenAddresses was incorrect. expected %v got %v", []string{"127.0.0.1:9983", "[::1]:9983"}, a)
+	}
+}